@@ -3,7 +3,10 @@ package bencode
 import (
 	"bufio"
 	"errors"
+	"fmt"
 	"io"
+	"math/big"
+	"sort"
 	"strconv"
 )
 
@@ -21,8 +24,49 @@ var (
 	ErrEpE = errors.New("expect char e")
 	ErrTyp = errors.New("wrong type")
 	ErrIvd = errors.New("invalid bencode")
+	ErrEnd = errors.New("unexpected char e")
+	ErrTrl = errors.New("expect end of data")
+	ErrUnk = errors.New("unknown field")
+	ErrRng = errors.New("integer out of range")
+	ErrZro = errors.New("expect no leading zero or negative zero")
+	ErrSrt = errors.New("expect sorted dict keys")
+	ErrDup = errors.New("expect unique dict keys")
+	ErrNil = errors.New("nil value has no bencode encoding")
+
+	ErrDepth	= errors.New("exceed max nesting depth")
+	ErrStrLen	= errors.New("exceed max string length")
+	ErrBytes	= errors.New("exceed max total bytes")
+	ErrEntries	= errors.New("exceed max list or dict entries")
 )
 
+//SyntaxError表示bencode数据的格式错误，Offset是出错位置(从0开始的字节偏移)，Err说明期望得到什么
+type SyntaxError struct {
+	Offset	int64
+	Err		error
+}
+
+func (e *SyntaxError) Error() string{
+	return fmt.Sprintf("bencode syntax error at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *SyntaxError) Unwrap() error{
+	return e.Err
+}
+
+//LimitError表示数据超出了DecoderOptions中的资源限制，Err是ErrDepth、ErrStrLen、ErrBytes或ErrEntries
+type LimitError struct {
+	Offset	int64
+	Err		error
+}
+
+func (e *LimitError) Error() string{
+	return fmt.Sprintf("bencode limit error at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *LimitError) Unwrap() error{
+	return e.Err
+}
+
 //Bobject表示
 
 type BType uint8
@@ -43,21 +87,77 @@ type BValue interface {
 type Bobject struct {
 	btype BType
 	bval BValue
+	raw []byte	//解析时记录的原始编码，可能为nil
 }
 
+//RawMessage保存一个值未经处理的bencode编码
+//Unmarshal时原样拷贝原始字节，Marshal时原样写出，用于需要逐字节保留的字段(如计算InfoSHA的info)
+type RawMessage []byte
+
 //对bval类型断言，返回该Bobject类型的对应类型
+//ParseBytes得到的string值保存为[]byte，引用原始数据
 func (o *Bobject)Str() (string, error){
 	if o.btype != Bstr{
 		return "", ErrTyp
 	}
+	if b, ok := o.bval.([]byte); ok{
+		return string(b), nil
+	}
 	return o.bval.(string), nil
 }
 
+//以[]byte形式返回string的值，对ParseBytes得到的Bobject不做拷贝
+func (o *Bobject)Bytes() ([]byte, error){
+	if o.btype != Bstr{
+		return nil, ErrTyp
+	}
+	if b, ok := o.bval.([]byte); ok{
+		return b, nil
+	}
+	return []byte(o.bval.(string)), nil
+}
+
+//int的值默认保存为int64，超出int64范围时(需要DecoderOptions.BigInt)保存为*big.Int
+//Int在值超出int范围时返回ErrRng
 func (o *Bobject)Int() (int, error){
+	val, err := o.Int64()
+	if err != nil{
+		return 0, err
+	}
+	if int64(int(val)) != val{
+		return 0, ErrRng
+	}
+	return int(val), nil
+}
+
+//Int64在值超出int64范围时返回ErrRng
+func (o *Bobject)Int64() (int64, error){
 	if o.btype != Bint{
 		return 0, ErrTyp
 	}
-	return o.bval.(int), nil
+	if val, ok := o.bval.(int64); ok{
+		return val, nil
+	}
+	return 0, ErrRng
+}
+
+//以*big.Int返回任意大小的int
+func (o *Bobject)BigInt() (*big.Int, error){
+	if o.btype != Bint{
+		return nil, ErrTyp
+	}
+	if val, ok := o.bval.(int64); ok{
+		return big.NewInt(val), nil
+	}
+	return new(big.Int).Set(o.bval.(*big.Int)), nil
+}
+
+//int的十进制表示
+func (o *Bobject)intString() string{
+	if val, ok := o.bval.(int64); ok{
+		return strconv.FormatInt(val, 10)
+	}
+	return o.bval.(*big.Int).String()
 }
 
 func (o *Bobject)List() ([]*Bobject, error){
@@ -75,62 +175,64 @@ func (o *Bobject)Dict() (map[string]*Bobject, error){
 }
 
 //Bobejct -> Bencode
-func (o *Bobject)Bencode(w io.Writer) int{
-	bw, ok := w.(*bufio.Writer)
-	if !ok{
-		bw = bufio.NewWriter(w)
-	}
+func (o *Bobject)Bencode(w io.Writer) (int, error){
+	bw := newWriter(w)
+	wlen, err := o.encode(bw)
+	return flushWriter(bw, wlen, err)
+}
+
+//把o编码写入bw的缓冲中，不Flush
+func (o *Bobject)encode(bw *bufio.Writer) (int, error){
 	wlen := 0	//写入writer的总长度
 
 	switch o.btype{
 	case Bstr:
 		val, _ := o.Str()
-		wlen += EncodeString(bw,val)
+		wlen += encodeString(bw,val)
 	case Bint:
-		val, _ := o.Int()
-		wlen += EncodeInt(bw,val)
+		wlen += encodeDigits(bw, o.intString())
 	case Blist:
 		bw.WriteByte('l')
 		val, _ := o.List()
 		for _, v := range val{
-			wlen += v.Bencode(bw)
+			n, err := v.encode(bw)
+			if err != nil{
+				return 0, err
+			}
+			wlen += n
 		}
 		bw.WriteByte('e')
 		wlen += 2
 	case Bdict:
 		bw.WriteByte('d')
 		val, _ := o.Dict()
-		for k, v := range val{
-			wlen += EncodeString(bw, k)	//写入key
-			wlen += v.Bencode(bw)		//写入value
+		//BEP 3要求dict的key按字典序排列，而map的遍历顺序是随机的，所以先对key排序
+		for _, k := range sortedKeys(val){
+			wlen += encodeString(bw, k)	//写入key
+			n, err := val[k].encode(bw)	//写入value
+			if err != nil{
+				return 0, err
+			}
+			wlen += n
 		}
 		bw.WriteByte('e')
 		wlen += 2
+	default:
+		return 0, ErrIvd
 	}
-	bw.Flush()
-	return wlen
+	return wlen, nil
 }
 
 //工具编写
 
-//将buifo.Reader中的内容读出，转化为一个十进制数
-func readDecimal(r *bufio.Reader)(val int, lenth int){
-	b, _  := r.ReadByte()
-	if b == 'i'{
-		str, _ := r.ReadString('e')
-		lenth = len(str)
-		str  = str[:lenth - 1]
-		lenth = len(str)
-		val, _ = strconv.Atoi(str)
-	}else{
-		for b != ':'{
-			val = val * 10 + int(b - '0')
-			lenth++
-			b, _ = r.ReadByte()
-		}
-		r.UnreadByte()
+//返回按字典序(原始字节)排列的dict的key
+func sortedKeys(dict map[string]*Bobject) []string{
+	keys := make([]string, 0, len(dict))
+	for k := range dict{
+		keys = append(keys, k)
 	}
-	return val, lenth
+	sort.Strings(keys)
+	return keys
 }
 
 //将一个十进制数以byte类型写入bufio.writer缓冲区
@@ -143,6 +245,27 @@ func writeDecimal(w *bufio.Writer, val int) (lenth int){
 	return lenth
 }
 
+//每次编码调用只使用一个bufio.Writer：w本身是bufio.Writer时直接使用
+func newWriter(w io.Writer) *bufio.Writer{
+	bw, ok := w.(*bufio.Writer)
+	if !ok{
+		bw = bufio.NewWriter(w)
+	}
+	return bw
+}
+
+//编码结束后把缓冲写入io中。bufio.Writer会记住第一次写入失败的错误，所以只需检查Flush
+func flushWriter(bw *bufio.Writer, wlen int, err error) (int, error){
+	if err != nil{
+		return 0, err
+	}
+	err = bw.Flush()
+	if err != nil{
+		return 0, err
+	}
+	return wlen, nil
+}
+
 /*
 	string编码过程：
 		1.将string长度以byte写入bufio.writer
@@ -150,12 +273,13 @@ func writeDecimal(w *bufio.Writer, val int) (lenth int){
 		3.写入要写入的string
 		4.最后用flush方法，将bufio缓冲中的信息写入io中
  */
-func EncodeString(w io.Writer, val string) int{
+func EncodeString(w io.Writer, val string) (int, error){
+	bw := newWriter(w)
+	return flushWriter(bw, encodeString(bw, val), nil)
+}
+
+func encodeString(bw *bufio.Writer, val string) int{
 	lenth := len(val)
-	bw, ok := w.(*bufio.Writer)
-	if !ok{
-		bw = bufio.NewWriter(w)
-	}
 	wlen := writeDecimal(bw, lenth)
 
 	bw.WriteByte(':')
@@ -163,12 +287,6 @@ func EncodeString(w io.Writer, val string) int{
 
 	bw.WriteString(val)
 	wlen += lenth
-
-	err := bw.Flush()
-	if err != nil{
-		return 0
-	}
-
 	return wlen
 }
 
@@ -179,67 +297,38 @@ func EncodeString(w io.Writer, val string) int{
 		2.写入一个'e'
 		4.最后用flush方法，将bufio缓冲中的信息写入io中
 */
-func EncodeInt(w io.Writer, val int) int{
-	bw, ok := w.(*bufio.Writer)
-	if !ok{
-		bw = bufio.NewWriter(w)
-	}
+func EncodeInt(w io.Writer, val int64) (int, error){
+	bw := newWriter(w)
+	return flushWriter(bw, encodeInt(bw, val), nil)
+}
+
+func encodeInt(bw *bufio.Writer, val int64) int{
+	return encodeDigits(bw, strconv.FormatInt(val, 10))
+}
 
+//写入'i' + 十进制数 + 'e'
+func encodeDigits(bw *bufio.Writer, digits string) int{
 	bw.WriteByte('i')
 	wlen := 1
 
-	lenth := writeDecimal(bw, val)
-	wlen += lenth
+	bw.WriteString(digits)
+	wlen += len(digits)
 
 	bw.WriteByte('e')
 	wlen++
-
-	err := bw.Flush()
-	if err != nil{
-		return 0
-	}
 	return wlen
 }
 
-/*
-	string解码过程：
-		1. 判断有无缓冲，若没有则new一个
-		2. 将缓冲的数字部分从缓冲中取出
-		3. 取出缓冲中的':'
-		4. 将缓冲中的字符串取出，字符串长度为num
-*/
+//从r中解码一个string
 func DecodeString(r io.Reader)(val string, err error){
-	br, ok := r.(*bufio.Reader)
-	if !ok{
-		br = bufio.NewReader(r)
-	}
-
-	num, lenth := readDecimal(br)
-	if lenth == 0{
-		return val, ErrNum
-	}
-
-	b, err := br.ReadByte()
-	if b != ':'{
-		return val, ErrCol
-	}
-
-	buf := make([]byte, num)
-	_, err = io.ReadAtLeast(br, buf, num)
-	val = string(buf)
-	return
+	return newParser(r, DecoderOptions{}).decodeString()
 }
 
-/*
-	int解码过程：
-		1. 判断有无缓冲，若没有则new一个
-		2. 将缓冲的数字部分从缓冲中取出
-*/
-func DecodeInt(r io.Reader)(val int, err error){
-	br, ok := r.(*bufio.Reader)
-	if !ok{
-		br = bufio.NewReader(r)
+//从r中解码一个int，超出int64范围时返回错误
+func DecodeInt(r io.Reader)(val int64, err error){
+	v, err := newParser(r, DecoderOptions{}).decodeInt()
+	if err != nil{
+		return 0, err
 	}
-	val, _ = readDecimal(br)
-	return
-}
\ No newline at end of file
+	return v.(int64), nil
+}
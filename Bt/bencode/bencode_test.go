@@ -0,0 +1,75 @@
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestString(t *testing.T){
+	val := "abc"
+	buf := new(bytes.Buffer)
+	wlen, err := EncodeString(buf, val)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 5, wlen)
+
+	val = ""
+	for i := 0; i < 20; i++ {
+		val += string(byte('a' + i))
+	}
+	buf.Reset()
+	wlen, _ = EncodeString(buf, val)
+	assert.Equal(t, 23, wlen)
+	str, _ := DecodeString(buf)
+	assert.Equal(t, val, str)
+}
+
+func TestInt(t *testing.T) {
+	val := int64(999)
+	buf := new(bytes.Buffer)
+	wLen, err := EncodeInt(buf, val)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 5, wLen)
+	iv, _ := DecodeInt(buf)
+	assert.Equal(t, val, iv)
+
+	val = -99
+	buf.Reset()
+	wLen, _ = EncodeInt(buf, val)
+	assert.Equal(t, 5, wLen)
+	iv, _ = DecodeInt(buf)
+	assert.Equal(t, val, iv)
+}
+
+var errWrite = errors.New("write failed")
+
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) {
+	return 0, errWrite
+}
+
+func TestEncodeError(t *testing.T) {
+	wlen, err := EncodeString(failWriter{}, "abc")
+	assert.Equal(t, errWrite, err)
+	assert.Equal(t, 0, wlen)
+
+	_, err = EncodeInt(failWriter{}, 1)
+	assert.Equal(t, errWrite, err)
+
+	o, _ := Parse(bytes.NewBufferString("li1ee"))
+	_, err = o.Bencode(failWriter{})
+	assert.Equal(t, errWrite, err)
+
+	_, err = Marshal(failWriter{}, user{"archer", 29})
+	assert.Equal(t, errWrite, err)
+
+	buf := new(bytes.Buffer)
+	_, err = Marshal(buf, struct{ F float64 }{1})
+	assert.True(t, errors.Is(err, ErrTyp))
+	_, err = Marshal(buf, map[int]int{1: 1})
+	assert.True(t, errors.Is(err, ErrTyp))
+	_, err = (&Bobject{}).Bencode(buf)
+	assert.Equal(t, ErrIvd, err)
+}
@@ -0,0 +1,215 @@
+package bencode
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+/*
+	构造和修改Bobject：
+		NewString、NewInt(NewInt64、NewBigInt)、NewList、NewDict创建Bobject
+		Set、Delete修改dict，Append修改list
+		Get按路径查找，路径用'.'分隔，dict用key，list用下标，如"info.files.0.path"
+*/
+
+var (
+	ErrKey = errors.New("key not found")
+	ErrIdx = errors.New("index out of range")
+)
+
+func (t BType) String() string{
+	switch t {
+	case Bstr:
+		return "string"
+	case Bint:
+		return "int"
+	case Blist:
+		return "list"
+	case Bdict:
+		return "dict"
+	}
+	return "invalid"
+}
+
+//PathError表示按路径查找失败，Path是出错的那一段之前已经找到的路径
+type PathError struct {
+	Path	string
+	Key		string	//出错的那一段
+	Err		error	//ErrKey、ErrIdx或ErrTyp
+}
+
+func (e *PathError) Error() string{
+	path := e.Key
+	if e.Path != ""{
+		path = e.Path + "." + e.Key
+	}
+	return fmt.Sprintf("bencode path %q: %v", path, e.Err)
+}
+
+func (e *PathError) Unwrap() error{
+	return e.Err
+}
+
+func NewString(val string) *Bobject{
+	return &Bobject{btype: Bstr, bval: val}
+}
+
+func NewInt(val int) *Bobject{
+	return NewInt64(int64(val))
+}
+
+func NewInt64(val int64) *Bobject{
+	return &Bobject{btype: Bint, bval: val}
+}
+
+//val在int64范围内时按int64保存
+func NewBigInt(val *big.Int) *Bobject{
+	if val.IsInt64(){
+		return NewInt64(val.Int64())
+	}
+	return &Bobject{btype: Bint, bval: new(big.Int).Set(val)}
+}
+
+func NewList(vals ...*Bobject) *Bobject{
+	list := make([]*Bobject, 0, len(vals))
+	list = append(list, vals...)
+	return &Bobject{btype: Blist, bval: list}
+}
+
+func NewDict() *Bobject{
+	return &Bobject{btype: Bdict, bval: make(map[string]*Bobject)}
+}
+
+func (o *Bobject) Type() BType{
+	return o.btype
+}
+
+//设置dict中key对应的值
+func (o *Bobject) Set(key string, val *Bobject) error{
+	dict, err := o.Dict()
+	if err != nil{
+		return err
+	}
+	if val == nil{
+		return ErrIvd
+	}
+	dict[key] = val
+	o.raw = nil		//修改后原始编码不再有效
+	return nil
+}
+
+//删除dict中的key，key不存在时返回ErrKey
+func (o *Bobject) Delete(key string) error{
+	dict, err := o.Dict()
+	if err != nil{
+		return err
+	}
+	if _, ok := dict[key]; !ok{
+		return ErrKey
+	}
+	delete(dict, key)
+	o.raw = nil
+	return nil
+}
+
+//在list的末尾追加元素
+func (o *Bobject) Append(vals ...*Bobject) error{
+	list, err := o.List()
+	if err != nil{
+		return err
+	}
+	for _, val := range vals{
+		if val == nil{
+			return ErrIvd
+		}
+	}
+	o.bval = append(list, vals...)
+	o.raw = nil
+	return nil
+}
+
+//按'.'分隔的路径查找，如"info.files.0.path"；path为空时返回o本身
+func (o *Bobject) Get(path string) (*Bobject, error){
+	if path == ""{
+		return o, nil
+	}
+	return o.Lookup(strings.Split(path, ".")...)
+}
+
+//按逐段给出的路径查找，key中可以包含'.'
+func (o *Bobject) Lookup(keys ...string) (*Bobject, error){
+	cur := o
+	for i, key := range keys{
+		var next *Bobject
+		switch cur.btype {
+		case Bdict:
+			dict, _ := cur.Dict()
+			next = dict[key]
+			if next == nil{
+				return nil, &PathError{strings.Join(keys[:i], "."), key, ErrKey}
+			}
+		case Blist:
+			list, _ := cur.List()
+			idx, err := strconv.Atoi(key)
+			if err != nil{
+				return nil, &PathError{strings.Join(keys[:i], "."), key, ErrTyp}
+			}
+			if idx < 0 || idx >= len(list){
+				return nil, &PathError{strings.Join(keys[:i], "."), key, ErrIdx}
+			}
+			next = list[idx]
+		default:
+			return nil, &PathError{strings.Join(keys[:i], "."), key, fmt.Errorf("%w: %v has no children", ErrTyp, cur.btype)}
+		}
+		cur = next
+	}
+	return cur, nil
+}
+
+//按路径查找一个string
+func (o *Bobject) GetStr(path string) (string, error){
+	obj, err := o.Get(path)
+	if err != nil{
+		return "", err
+	}
+	val, err := obj.Str()
+	if err != nil{
+		return "", typeMismatch(path, Bstr, obj.btype)
+	}
+	return val, nil
+}
+
+//按路径查找一个int，超出int范围时返回ErrRng
+func (o *Bobject) GetInt(path string) (int, error){
+	val, err := o.GetInt64(path)
+	if err != nil{
+		return 0, err
+	}
+	if int64(int(val)) != val{
+		return 0, ErrRng
+	}
+	return int(val), nil
+}
+
+//按路径查找一个int64，超出int64范围时返回ErrRng
+func (o *Bobject) GetInt64(path string) (int64, error){
+	obj, err := o.Get(path)
+	if err != nil{
+		return 0, err
+	}
+	if obj.btype != Bint{
+		return 0, typeMismatch(path, Bint, obj.btype)
+	}
+	return obj.Int64()
+}
+
+func typeMismatch(path string, expect BType, got BType) error{
+	parent, key := "", path
+	if idx := strings.LastIndex(path, "."); idx >= 0{
+		parent, key = path[:idx], path[idx + 1:]
+	}
+	return &PathError{parent, key, fmt.Errorf("%w: expect %v, got %v", ErrTyp, expect, got)}
+}
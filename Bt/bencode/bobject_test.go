@@ -0,0 +1,72 @@
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildBobject(t *testing.T) {
+	files := NewList()
+	file := NewDict()
+	assert.Equal(t, nil, file.Set("length", NewInt(5)))
+	assert.Equal(t, nil, file.Set("path", NewList(NewString("dir"), NewString("a.txt"))))
+	assert.Equal(t, nil, files.Append(file))
+	info := NewDict()
+	info.Set("name", NewString("root"))
+	info.Set("files", files)
+	info.Set("tmp", NewInt(0))
+	assert.Equal(t, nil, info.Delete("tmp"))
+	assert.Equal(t, ErrKey, info.Delete("tmp"))
+	root := NewDict()
+	root.Set("info", info)
+
+	out := new(bytes.Buffer)
+	_, err := root.Bencode(out)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "d4:infod5:filesld6:lengthi5e4:pathl3:dir5:a.txteee4:name4:rootee", out.String())
+
+	assert.Equal(t, ErrTyp, NewInt(1).Set("a", NewInt(1)))
+	assert.Equal(t, ErrTyp, NewDict().Append(NewInt(1)))
+}
+
+func TestGetPath(t *testing.T) {
+	in := "d4:infod5:filesld6:lengthi5e4:pathl3:dir5:a.txteee4:name4:rootee"
+	o, _ := Parse(bytes.NewBufferString(in))
+
+	name, err := o.GetStr("info.name")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "root", name)
+	length, err := o.GetInt("info.files.0.length")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 5, length)
+	p, err := o.Get("info.files.0.path.1")
+	assert.Equal(t, nil, err)
+	str, _ := p.Str()
+	assert.Equal(t, "a.txt", str)
+	p, err = o.Lookup("info", "files", "0", "path")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Blist, p.Type())
+
+	var pe *PathError
+	_, err = o.Get("info.files.1")
+	assert.True(t, errors.As(err, &pe))
+	assert.Equal(t, "info.files", pe.Path)
+	assert.True(t, errors.Is(err, ErrIdx))
+
+	_, err = o.Get("info.length")
+	assert.True(t, errors.Is(err, ErrKey))
+	assert.Equal(t, `bencode path "info.length": key not found`, err.Error())
+
+	_, err = o.Get("info.name.x")
+	assert.True(t, errors.Is(err, ErrTyp))
+	_, err = o.Get("info.files.x")
+	assert.True(t, errors.Is(err, ErrTyp))
+
+	_, err = o.GetInt("info.name")
+	assert.True(t, errors.As(err, &pe))
+	assert.Equal(t, "info", pe.Path)
+	assert.True(t, errors.Is(err, ErrTyp))
+}
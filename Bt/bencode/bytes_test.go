@@ -0,0 +1,99 @@
+package bencode
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type benchInfo struct {
+	Length		int			`bencode:"length"`
+	Name		string		`bencode:"name"`
+	PieceLength	int			`bencode:"piece length"`
+	Pieces		[]byte		`bencode:"pieces"`
+}
+
+type benchFile struct {
+	Announce	string		`bencode:"announce"`
+	Comment		string		`bencode:"comment"`
+	Info		benchInfo	`bencode:"info"`
+}
+
+func readTorrent(t testing.TB) []byte {
+	data, err := os.ReadFile("../testfile/debian-iso.torrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseBytesAlias(t *testing.T) {
+	data := []byte("d4:listl3:abce4:name6:archere")
+	o, err := ParseBytes(data)
+	assert.Equal(t, nil, err)
+	dict, _ := o.Dict()
+	name, _ := dict["name"].Bytes()
+	assert.Equal(t, "archer", string(name))
+	//string值引用data
+	data[22] = 'A'
+	assert.Equal(t, "Archer", string(name))
+	str, _ := dict["name"].Str()
+	assert.Equal(t, "Archer", str)
+
+	out := new(bytes.Buffer)
+	_, err = o.Bencode(out)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, string(data), out.String())
+}
+
+func TestUnmarshalBytes(t *testing.T) {
+	data := readTorrent(t)
+	f1 := new(benchFile)
+	assert.Equal(t, nil, Unmarshal(bytes.NewReader(data), f1))
+	f2 := new(benchFile)
+	assert.Equal(t, nil, UnmarshalBytes(data, f2))
+	assert.Equal(t, f1, f2)
+	assert.Equal(t, 1512*20, len(f2.Info.Pieces))
+
+	var v interface{}
+	assert.Equal(t, nil, UnmarshalBytes([]byte("li1e1:ae"), &v))
+	assert.Equal(t, []interface{}{int64(1), "a"}, v)
+
+	_, err := ParseBytes([]byte("li1e"))
+	assertSyntaxError(t, err, 4, io.ErrUnexpectedEOF)
+	_, err = ParseBytes([]byte("5:abc"))
+	assertSyntaxError(t, err, 5, io.ErrUnexpectedEOF)
+	_, err = DecoderOptions{Strict: true}.ParseBytes([]byte("i03e"))
+	assertSyntaxError(t, err, 1, ErrZro)
+	err = DecoderOptions{Strict: true}.UnmarshalBytes([]byte("i1ei2e"), &v)
+	assertSyntaxError(t, err, 3, ErrTrl)
+	_, err = DecoderOptions{MaxBytes: 4}.ParseBytes([]byte("3:abc"))
+	assertLimitError(t, err, ErrBytes)
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	data := readTorrent(b)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		f := new(benchFile)
+		if err := Unmarshal(bytes.NewReader(data), f); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalBytes(b *testing.B) {
+	data := readTorrent(b)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		f := new(benchFile)
+		if err := UnmarshalBytes(data, f); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
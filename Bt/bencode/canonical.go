@@ -0,0 +1,42 @@
+package bencode
+
+import (
+	"bytes"
+	"io"
+)
+
+/*
+	规范编码(BEP 3)：
+		1. dict的key按原始字节的字典序排列，且不能重复
+		2. int没有前导0，也没有-0
+	同一个Bobject只有一种规范编码，所以基于它计算的SHA(如InfoSHA)才是稳定的
+*/
+
+//把一段bencode数据重新编码为规范形式
+//data必须恰好是一个值：后面有多余的数据或dict中有重复的key时返回错误，否则会丢掉一部分数据
+func Canonicalize(data []byte) ([]byte, error){
+	p := newBytesParser(data, DecoderOptions{})
+	p.unique = true
+	obj, err := p.parse()
+	if err != nil{
+		return nil, err
+	}
+	if _, err := p.peek(); err != io.EOF{
+		return nil, &SyntaxError{p.off, ErrTrl}
+	}
+	buf := new(bytes.Buffer)
+	_, err = obj.Bencode(buf)
+	if err != nil{
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+//判断一段bencode数据是否已经是规范形式：规范化后应与原数据逐字节相同
+func IsCanonical(data []byte) bool{
+	c, err := Canonicalize(data)
+	if err != nil{
+		return false
+	}
+	return bytes.Equal(c, data)
+}
@@ -0,0 +1,59 @@
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBencodeSortedKeys(t *testing.T) {
+	in := "d4:name6:archer3:agei29e1:ai1ee"
+	o, err := Parse(bytes.NewBufferString(in))
+	assert.Equal(t, nil, err)
+	out := new(bytes.Buffer)
+	wlen, err := o.Bencode(out)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, len(in), wlen)
+	assert.Equal(t, "d1:ai1e3:agei29e4:name6:archere", out.String())
+}
+
+type unsortedStruct struct {
+	Name	string	`bencode:"name"`
+	Age		int		`bencode:"age"`
+	Piece	int		`bencode:"piece length"`
+}
+
+func TestMarshalSortedKeys(t *testing.T) {
+	out := new(bytes.Buffer)
+	s := unsortedStruct{"archer", 29, 16}
+	wlen, err := Marshal(out, s)
+	assert.Equal(t, nil, err)
+	expect := "d3:agei29e4:name6:archer12:piece lengthi16ee"
+	assert.Equal(t, expect, out.String())
+	assert.Equal(t, len(expect), wlen)
+	assert.True(t, IsCanonical(out.Bytes()))
+}
+
+func TestCanonicalize(t *testing.T) {
+	c, err := Canonicalize([]byte("d1:bi2e1:ali1ei2eee"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "d1:ali1ei2ee1:bi2ee", string(c))
+	assert.True(t, IsCanonical(c))
+
+	assert.False(t, IsCanonical([]byte("d1:bi2e1:ai1ee")))
+	assert.False(t, IsCanonical([]byte("i03e")))
+	assert.False(t, IsCanonical([]byte("d1:ai1e1:ai2ee")))
+	assert.False(t, IsCanonical([]byte("i1ei2e")))
+
+	//多余的数据和重复的key不能被静默丢掉
+	_, err = Canonicalize([]byte("i1ei2e"))
+	assert.True(t, errors.Is(err, ErrTrl))
+	_, err = Canonicalize([]byte("d1:ai1e1:ai2ee"))
+	assert.True(t, errors.Is(err, ErrDup))
+	_, err = Canonicalize([]byte("d1:bi1e1:ai2e1:bi3ee"))
+	assert.True(t, errors.Is(err, ErrDup))
+	_, err = Canonicalize([]byte("i1e "))
+	assert.True(t, errors.Is(err, ErrTrl))
+}
@@ -0,0 +1,191 @@
+package bencode
+
+import (
+	"bytes"
+	"io"
+)
+
+/*
+	流式编解码：
+		Decoder从io.Reader中逐个读出值，一个流中可以有多个连续的值
+		Decode每次读出一个完整的值；Token每次只读出一个记号，不需要构造整棵Bobject树
+		Encoder把值逐个编码写入io.Writer
+*/
+
+//Token是Decoder.Token返回的记号：Delim、string或int64(DecoderOptions.BigInt时可能是*big.Int)
+type Token interface {
+
+}
+
+//Delim表示dict开始('d')、list开始('l')或结束('e')
+type Delim byte
+
+const (
+	DictStart	Delim = 'd'
+	ListStart	Delim = 'l'
+	End			Delim = 'e'
+)
+
+type Decoder struct {
+	p		*parser
+	opts	DecoderOptions
+	stack	[]tokenLevel	//Token读到的未结束的list和dict
+}
+
+//Token读到的一层list或dict
+type tokenLevel struct {
+	kind	Delim
+	key		bool	//dict中下一个记号应该是key
+}
+
+func NewDecoder(r io.Reader) *Decoder{
+	return DecoderOptions{}.NewDecoder(r)
+}
+
+//之后Decode时，dict中有struct没有对应字段的key则返回错误
+func (d *Decoder) DisallowUnknownFields(){
+	d.opts.DisallowUnknownFields = true
+}
+
+//从流中读出下一个完整的值，赋值给v
+//v可以是*Bobject，也可以是Unmarshal支持的类型；流结束时返回io.EOF
+func (d *Decoder) Decode(v interface{}) error{
+	if len(d.stack) > 0{
+		if c, err := d.p.peek(); err == nil{
+			if err := d.check(c); err != nil{
+				return err
+			}
+		}
+	}
+	obj, err := d.p.parseRaw()
+	if err != nil{
+		return err
+	}
+	d.next()
+	if o, ok := v.(*Bobject); ok{
+		*o = *obj
+		return nil
+	}
+	return unmarshal(obj, v, d.opts)
+}
+
+//读出下一个记号：
+//	dict、list开始和结束时返回Delim，string返回string，int返回int64
+//dict中的key和value都以string/Token的形式依次返回；流结束时返回io.EOF
+func (d *Decoder) Token() (Token, error){
+	c, err := d.p.peek()
+	if err != nil{
+		if len(d.stack) > 0{
+			return nil, d.p.unexpected(err)
+		}
+		return nil, err
+	}
+	if len(d.stack) == 0{
+		d.p.start = d.p.off
+	}
+	if err := d.check(c); err != nil{
+		return nil, err
+	}
+	switch {
+	case c == 'd' || c == 'l':
+		if len(d.stack) >= d.p.opts.maxDepth(){
+			return nil, &LimitError{d.p.off, ErrDepth}
+		}
+		if _, err := d.p.readByte(); err != nil{
+			return nil, err
+		}
+		//list或dict本身是外层的一个值
+		d.next()
+		d.stack = append(d.stack, tokenLevel{kind: Delim(c), key: c == 'd'})
+		return Delim(c), nil
+	case c == 'e':
+		if len(d.stack) == 0{
+			return nil, &SyntaxError{d.p.off, ErrEnd}
+		}
+		if _, err := d.p.readByte(); err != nil{
+			return nil, err
+		}
+		d.stack = d.stack[:len(d.stack) - 1]
+		return End, nil
+	case c == 'i':
+		val, err := d.p.decodeInt()
+		if err != nil{
+			return nil, err
+		}
+		d.next()
+		return val, nil
+	case c >= '0' && c <= '9':
+		val, err := d.p.decodeString()
+		if err != nil{
+			return nil, err
+		}
+		d.next()
+		return val, nil
+	}
+	return nil, &SyntaxError{d.p.off, ErrIvd}
+}
+
+//检查以c开始的记号能否出现在当前位置，错误和Parse一致：
+//dict中的key必须是string，dict不能在key之后、value之前结束
+func (d *Decoder) check(c byte) error{
+	if len(d.stack) == 0{
+		return nil
+	}
+	top := d.stack[len(d.stack) - 1]
+	if top.kind != DictStart{
+		return nil
+	}
+	if top.key && c != 'e' && !(c >= '0' && c <= '9'){
+		return &SyntaxError{d.p.off, ErrNum}
+	}
+	if !top.key && c == 'e'{
+		return &SyntaxError{d.p.off, ErrIvd}
+	}
+	return nil
+}
+
+//读出一个完整的值后，dict在key和value之间切换
+func (d *Decoder) next(){
+	if n := len(d.stack); n > 0 && d.stack[n - 1].kind == DictStart{
+		d.stack[n - 1].key = !d.stack[n - 1].key
+	}
+}
+
+//当前的list或dict中是否还有元素(流的最外层则表示是否还有值)
+func (d *Decoder) More() bool{
+	c, err := d.p.peek()
+	return err == nil && c != 'e'
+}
+
+//已经从流中取出的字节数
+func (d *Decoder) InputOffset() int64{
+	return d.p.off
+}
+
+type Encoder struct {
+	w io.Writer
+}
+
+func NewEncoder(w io.Writer) *Encoder{
+	return &Encoder{w: w}
+}
+
+//把v编码后写入流中，v可以是*Bobject，也可以是Marshal支持的类型
+func (e *Encoder) Encode(v interface{}) error{
+	//先完整编码到buf中再写入，编码失败时不会写入半个值
+	buf := new(bytes.Buffer)
+	var err error
+	switch o := v.(type) {
+	case *Bobject:
+		_, err = o.Bencode(buf)
+	case Bobject:
+		_, err = o.Bencode(buf)
+	default:
+		_, err = Marshal(buf, v)
+	}
+	if err != nil{
+		return err
+	}
+	_, err = e.w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,144 @@
+package bencode
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type user struct {
+	Name	string	`bencode:"name"`
+	Age		int		`bencode:"age"`
+}
+
+func TestDecoderMultiValues(t *testing.T) {
+	in := "d4:name6:archer3:agei29eed4:name3:bob3:agei30eei7e"
+	dec := NewDecoder(bytes.NewBufferString(in))
+
+	u := new(user)
+	assert.Equal(t, nil, dec.Decode(u))
+	assert.Equal(t, user{"archer", 29}, *u)
+	assert.Equal(t, nil, dec.Decode(u))
+	assert.Equal(t, user{"bob", 30}, *u)
+
+	var o Bobject
+	assert.Equal(t, nil, dec.Decode(&o))
+	val, err := o.Int()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 7, val)
+
+	assert.Equal(t, io.EOF, dec.Decode(&o))
+}
+
+func TestDecoderToken(t *testing.T) {
+	in := "d4:listli1e3:abce3:numi-5ee"
+	dec := NewDecoder(bytes.NewBufferString(in))
+	var tokens []Token
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		assert.Equal(t, nil, err)
+		tokens = append(tokens, tok)
+	}
+	expect := []Token{DictStart, "list", ListStart, int64(1), "abc", End, "num", int64(-5), End}
+	assert.Equal(t, expect, tokens)
+
+	dec = NewDecoder(bytes.NewBufferString("ll"))
+	dec.Token()
+	dec.Token()
+	_, err := dec.Token()
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	dec = NewDecoder(bytes.NewBufferString("li1ee"))
+	_, err = dec.Token()
+	assert.Equal(t, nil, err)
+	assert.True(t, dec.More())
+	dec.Token()
+	assert.False(t, dec.More())
+}
+
+func TestDecoderTokenDict(t *testing.T) {
+	//dict中的key必须是string，key之后必须有value，和Parse一样返回带位置的SyntaxError
+	for _, c := range []struct {
+		in		string
+		tokens	int		//出错前正确读出的记号数
+		off		int64
+		err		error
+	}{
+		{"di1ei2ee", 1, 1, ErrNum},
+		{"dlee", 1, 1, ErrNum},
+		{"d1:ae", 2, 4, ErrIvd},
+		{"ld1:ai1e1:bee", 5, 11, ErrIvd},
+	} {
+		dec := NewDecoder(bytes.NewBufferString(c.in))
+		for i := 0; i < c.tokens; i++ {
+			_, err := dec.Token()
+			assert.Equal(t, nil, err, c.in)
+		}
+		_, err := dec.Token()
+		var se *SyntaxError
+		if assert.ErrorAs(t, err, &se, c.in) {
+			assert.Equal(t, c.off, se.Offset, c.in)
+			assert.ErrorIs(t, err, c.err, c.in)
+		}
+		_, err = Parse(bytes.NewBufferString(c.in))
+		assert.ErrorIs(t, err, c.err, c.in)
+	}
+
+	//value是list或dict时，结束后回到key
+	dec := NewDecoder(bytes.NewBufferString("d1:ald1:bi1eee1:ci2ee"))
+	var tokens []Token
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		assert.Equal(t, nil, err)
+		tokens = append(tokens, tok)
+	}
+	assert.Equal(t, []Token{DictStart, "a", ListStart, DictStart, "b", int64(1), End, End, "c", int64(2), End}, tokens)
+
+	//Token和Decode混合使用
+	dec = NewDecoder(bytes.NewBufferString("d1:ali1ee1:bi2ee"))
+	dec.Token()
+	key, _ := dec.Token()
+	assert.Equal(t, "a", key)
+	var list []int
+	assert.Equal(t, nil, dec.Decode(&list))
+	assert.Equal(t, []int{1}, list)
+	key, _ = dec.Token()
+	assert.Equal(t, "b", key)
+	var val int
+	assert.Equal(t, nil, dec.Decode(&val))
+	tok, err := dec.Token()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, End, tok)
+
+	dec = NewDecoder(bytes.NewBufferString("di1ei2ee"))
+	dec.Token()
+	assert.ErrorIs(t, dec.Decode(&val), ErrNum)
+}
+
+func TestDecoderTruncated(t *testing.T) {
+	dec := NewDecoder(bytes.NewBufferString("d4:name6:arc"))
+	err := dec.Decode(new(user))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestEncoder(t *testing.T) {
+	out := new(bytes.Buffer)
+	enc := NewEncoder(out)
+	assert.Equal(t, nil, enc.Encode(user{"archer", 29}))
+	o, _ := Parse(bytes.NewBufferString("li1ee"))
+	assert.Equal(t, nil, enc.Encode(o))
+	assert.Equal(t, "d3:agei29e4:name6:archereli1ee", out.String())
+
+	dec := NewDecoder(out)
+	u := new(user)
+	assert.Equal(t, nil, dec.Decode(u))
+	assert.Equal(t, "archer", u.Name)
+}
@@ -0,0 +1,106 @@
+package bencode
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+/*
+	struct tag：`bencode:"key,选项..."`
+		key为空时使用小写的字段名；key为"-"时忽略该字段
+		omitempty：值为空(0、false、空string/slice/map、nil)时，编码时省略
+		unknown：字段必须是key为string的map，解码时收集没有对应字段的key，编码时原样写回
+*/
+
+//struct中一个字段的编解码信息
+type field struct {
+	index		int		//字段下标
+	key			string	//dict中的key
+	omitEmpty	bool
+}
+
+type structFields struct {
+	fields	[]field
+	byKey	map[string]int	//key -> fields中的下标
+	unknown	int				//unknown字段的下标，没有则为-1
+}
+
+//每个struct类型的字段信息只解析一次：reflect.Type -> *structFields
+var fieldCache sync.Map
+
+//得到struct所有参与编解码的字段
+func typeFields(t reflect.Type) *structFields{
+	if sf, ok := fieldCache.Load(t); ok{
+		return sf.(*structFields)
+	}
+	sf, _ := fieldCache.LoadOrStore(t, parseFields(t))
+	return sf.(*structFields)
+}
+
+//解析struct的tag
+func parseFields(t reflect.Type) *structFields{
+	sf := &structFields{unknown: -1}
+	for i := 0; i < t.NumField(); i++{
+		ft := t.Field(i)
+		//未导出的字段不参与编解码
+		if ft.PkgPath != ""{
+			continue
+		}
+		tag := ft.Tag.Get("bencode")
+		if tag == "-"{
+			continue
+		}
+		key, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx >= 0{
+			key, opts = tag[:idx], tag[idx + 1:]
+		}
+		f := field{index: i, key: key}
+		for _, opt := range strings.Split(opts, ","){
+			switch opt {
+			case "omitempty":
+				f.omitEmpty = true
+			case "unknown":
+				if ft.Type.Kind() == reflect.Map && ft.Type.Key().Kind() == reflect.String{
+					sf.unknown = i
+				}
+			}
+		}
+		if sf.unknown == i{
+			continue
+		}
+		if f.key == ""{
+			f.key = strings.ToLower(ft.Name)
+		}
+		sf.fields = append(sf.fields, f)
+	}
+	//多个字段使用同一个key时只保留第一个，避免编码出重复的key
+	sf.byKey = make(map[string]int, len(sf.fields))
+	fields := sf.fields[:0]
+	for _, f := range sf.fields{
+		if _, ok := sf.byKey[f.key]; ok{
+			continue
+		}
+		sf.byKey[f.key] = len(fields)
+		fields = append(fields, f)
+	}
+	sf.fields = fields
+	return sf
+}
+
+//判断值是否为空，用于omitempty
+func isEmptyValue(v reflect.Value) bool{
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type tagged struct {
+	Name	string				`bencode:"name"`
+	Comment	string				`bencode:"comment,omitempty"`
+	Private	int					`bencode:",omitempty"`
+	Skip	string				`bencode:"-"`
+	Extra	map[string]Bobject	`bencode:",unknown"`
+}
+
+func TestTagOptions(t *testing.T) {
+	out := new(bytes.Buffer)
+	Marshal(out, tagged{Name: "a", Skip: "x"})
+	assert.Equal(t, "d4:name1:ae", out.String())
+
+	out.Reset()
+	Marshal(out, tagged{Name: "a", Comment: "c", Private: 1})
+	assert.Equal(t, "d7:comment1:c4:name1:a7:privatei1ee", out.String())
+}
+
+func TestUnknownFields(t *testing.T) {
+	in := "d1:-1:x6:source3:abc4:name1:a5:otherli1eee"
+	s := new(tagged)
+	err := Unmarshal(bytes.NewBufferString(in), s)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "a", s.Name)
+	assert.Equal(t, "", s.Skip)
+	assert.Equal(t, 3, len(s.Extra))
+	src := s.Extra["source"]
+	str, _ := src.Str()
+	assert.Equal(t, "abc", str)
+
+	//未知的key原样写回
+	out := new(bytes.Buffer)
+	Marshal(out, s)
+	assert.Equal(t, "d1:-1:x4:name1:a5:otherli1ee6:source3:abce", out.String())
+
+	strict := DecoderOptions{DisallowUnknownFields: true}
+	assert.Equal(t, nil, strict.Unmarshal(bytes.NewBufferString(in), new(tagged)))
+	err = strict.Unmarshal(bytes.NewBufferString("d4:infod4:name1:a1:xi1eee"), &struct {
+		Info user `bencode:"info"`
+	}{})
+	assert.True(t, errors.Is(err, ErrUnk))
+
+	dec := NewDecoder(bytes.NewBufferString("d4:name1:a1:xi1ee"))
+	dec.DisallowUnknownFields()
+	assert.True(t, errors.Is(dec.Decode(new(user)), ErrUnk))
+}
@@ -0,0 +1,68 @@
+package bencode
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type counters struct {
+	Uploaded	int64		`bencode:"uploaded"`
+	Left		uint64		`bencode:"left"`
+	Small		int32		`bencode:"small"`
+	Huge		*big.Int	`bencode:"huge"`
+}
+
+func TestInt64(t *testing.T) {
+	in := "d4:hugei-123456789012345678901234567890e4:lefti18446744073709551615e5:smalli7e8:uploadedi9223372036854775807ee"
+	opts := DecoderOptions{BigInt: true}
+	c := new(counters)
+	err := opts.Unmarshal(bytes.NewBufferString(in), c)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(math.MaxInt64), c.Uploaded)
+	assert.Equal(t, uint64(math.MaxUint64), c.Left)
+	assert.Equal(t, int32(7), c.Small)
+	assert.Equal(t, "-123456789012345678901234567890", c.Huge.String())
+
+	out := new(bytes.Buffer)
+	_, err = Marshal(out, c)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, in, out.String())
+
+	//默认不解码超出int64的值
+	_, err = Parse(bytes.NewBufferString("i9223372036854775808e"))
+	assertSyntaxError(t, err, 1, ErrRng)
+
+	o, err := opts.Parse(bytes.NewBufferString("i9223372036854775808e"))
+	assert.Equal(t, nil, err)
+	_, err = o.Int64()
+	assert.Equal(t, ErrRng, err)
+	b, err := o.BigInt()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "9223372036854775808", b.String())
+	out.Reset()
+	o.Bencode(out)
+	assert.Equal(t, "i9223372036854775808e", out.String())
+
+	//超出目标字段的范围时返回ErrRng，而不是截断
+	err = Unmarshal(bytes.NewBufferString("d5:smalli2147483648ee"), c)
+	assert.ErrorIs(t, err, ErrRng)
+	var i64 int64
+	err = opts.Unmarshal(bytes.NewBufferString("i9223372036854775808e"), &i64)
+	assert.ErrorIs(t, err, ErrRng)
+
+	js, err := ToJSON(o, "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "9223372036854775808\n", string(js))
+	back, err := FromJSON(js)
+	assert.Equal(t, nil, err)
+	b, _ = back.BigInt()
+	assert.Equal(t, "9223372036854775808", b.String())
+
+	assert.Equal(t, Bint, NewBigInt(big.NewInt(5)).Type())
+	v, _ := NewBigInt(big.NewInt(5)).Int64()
+	assert.Equal(t, int64(5), v)
+}
@@ -0,0 +1,148 @@
+package bencode
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+	Bencode <-> JSON：
+		int <-> number，list <-> array，dict <-> object
+		string是合法的UTF-8时直接转为JSON string；
+		否则(如pieces、紧凑的peers)转为JSONBinaryPrefix + base64编码的string
+		本身以JSONBinaryPrefix开头的string也按base64编码，所以转换是可逆的
+	dict的key也按同样的规则转换
+*/
+
+const JSONBinaryPrefix = "base64:"
+
+//把Bobject转为JSON，indent不为空时按indent缩进
+func ToJSON(o *Bobject, indent string) ([]byte, error){
+	val, err := toJSONValue(o)
+	if err != nil{
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	err = enc.Encode(val)
+	if err != nil{
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func toJSONValue(o *Bobject) (interface{}, error){
+	switch o.btype {
+	case Bstr:
+		val, _ := o.Bytes()
+		return jsonString(val), nil
+	case Bint:
+		return json.Number(o.intString()), nil
+	case Blist:
+		list, _ := o.List()
+		vals := make([]interface{}, len(list))
+		for i, e := range list{
+			val, err := toJSONValue(e)
+			if err != nil{
+				return nil, err
+			}
+			vals[i] = val
+		}
+		return vals, nil
+	case Bdict:
+		dict, _ := o.Dict()
+		vals := make(map[string]interface{}, len(dict))
+		for k, e := range dict{
+			val, err := toJSONValue(e)
+			if err != nil{
+				return nil, err
+			}
+			vals[jsonString([]byte(k))] = val
+		}
+		return vals, nil
+	}
+	return nil, ErrIvd
+}
+
+func jsonString(val []byte) string{
+	if utf8.Valid(val) && !bytes.HasPrefix(val, []byte(JSONBinaryPrefix)){
+		return string(val)
+	}
+	return JSONBinaryPrefix + base64.StdEncoding.EncodeToString(val)
+}
+
+//把ToJSON得到的JSON转回Bobject
+func FromJSON(data []byte) (*Bobject, error){
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()		//保留整数的精度
+	var val interface{}
+	err := dec.Decode(&val)
+	if err != nil{
+		return nil, err
+	}
+	return fromJSONValue(val)
+}
+
+func fromJSONValue(val interface{}) (*Bobject, error){
+	switch v := val.(type) {
+	case string:
+		str, err := bencodeString(v)
+		if err != nil{
+			return nil, err
+		}
+		return NewString(str), nil
+	case json.Number:
+		num, err := v.Int64()
+		if err == nil{
+			return NewInt64(num), nil
+		}
+		b, ok := new(big.Int).SetString(v.String(), 10)
+		if !ok{
+			return nil, fmt.Errorf("%w: %v is not an integer", ErrTyp, v)
+		}
+		return NewBigInt(b), nil
+	case []interface{}:
+		list := NewList()
+		for _, e := range v{
+			obj, err := fromJSONValue(e)
+			if err != nil{
+				return nil, err
+			}
+			list.Append(obj)
+		}
+		return list, nil
+	case map[string]interface{}:
+		dict := NewDict()
+		for k, e := range v{
+			key, err := bencodeString(k)
+			if err != nil{
+				return nil, err
+			}
+			obj, err := fromJSONValue(e)
+			if err != nil{
+				return nil, err
+			}
+			dict.Set(key, obj)
+		}
+		return dict, nil
+	}
+	return nil, fmt.Errorf("%w: no bencode value for JSON %T", ErrTyp, val)
+}
+
+func bencodeString(val string) (string, error){
+	if !strings.HasPrefix(val, JSONBinaryPrefix){
+		return val, nil
+	}
+	buf, err := base64.StdEncoding.DecodeString(val[len(JSONBinaryPrefix):])
+	if err != nil{
+		return "", err
+	}
+	return string(buf), nil
+}
@@ -0,0 +1,40 @@
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSON(t *testing.T) {
+	in := "d3:binl2:\xff\x007:base64:e4:infod6:lengthi5e4:name3:abce2:\xfe\xfd3:<&>e"
+	o, err := Parse(bytes.NewBufferString(in))
+	assert.Equal(t, nil, err)
+
+	js, err := ToJSON(o, "")
+	assert.Equal(t, nil, err)
+	expect := `{"base64:/v0=":"<&>","bin":["base64:/wA=","base64:YmFzZTY0Og=="],"info":{"length":5,"name":"abc"}}` + "\n"
+	assert.Equal(t, expect, string(js))
+
+	back, err := FromJSON(js)
+	assert.Equal(t, nil, err)
+	out := new(bytes.Buffer)
+	_, err = back.Bencode(out)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, in, out.String())
+
+	pretty, err := ToJSON(back, "  ")
+	assert.Equal(t, nil, err)
+	assert.Contains(t, string(pretty), "\n  \"info\": {\n    \"length\": 5,")
+}
+
+func TestFromJSONInvalid(t *testing.T) {
+	for _, in := range []string{`1.5`, `null`, `true`, `{"a":[1,null]}`} {
+		_, err := FromJSON([]byte(in))
+		assert.True(t, errors.Is(err, ErrTyp), in)
+	}
+	_, err := FromJSON([]byte(`"base64:!!"`))
+	assert.NotEqual(t, nil, err)
+}
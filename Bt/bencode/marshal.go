@@ -1,58 +1,226 @@
 package bencode
 
 import (
+	"bufio"
+	"fmt"
 	"io"
+	"math/big"
 	"reflect"
-	"strings"
+	"sort"
+	"strconv"
 )
 
-func Marshal(w io.Writer, s interface{}) int{
+/*
+	Go类型 -> Bencode：
+		string、[]byte、[N]byte		-> string
+		int*、uint*、big.Int、bool(0/1)	-> int
+		slice、array				-> list
+		struct、key为string的map		-> dict
+		指针和interface按指向的值编码，nil在dict中省略该key，在list中和顶层没有对应的编码，返回ErrNil
+	实现了Marshaler的类型由自己编码；struct tag的用法见fields.go
+	返回写入的长度，不支持的类型或写入失败时返回错误
+*/
+func Marshal(w io.Writer, s interface{}) (int, error){
 	v := reflect.ValueOf(s)
+	if isNilValue(v){
+		return 0, ErrNil
+	}
 	if v.Kind() == reflect.Ptr{
 		v = v.Elem()
 	}
-	return  marshalValue(w, v)
+	bw := newWriter(w)
+	wlen, err := marshalValue(bw, v)
+	return flushWriter(bw, wlen, err)
+}
+
+//Marshaler由类型自己生成bencode编码，返回值必须是一个完整的bencode值
+type Marshaler interface {
+	MarshalBencode() ([]byte, error)
+}
+
+var (
+	rawMessageType = reflect.TypeOf(RawMessage(nil))
+	bobjectType = reflect.TypeOf(Bobject{})
+	marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	bigIntType = reflect.TypeOf(big.Int{})
+)
+
+//如果v(或可寻址的v的指针)实现了Marshaler，返回对应的Marshaler
+func asMarshaler(v reflect.Value) (Marshaler, bool){
+	if v.Kind() == reflect.Ptr && v.IsNil(){
+		return nil, false
+	}
+	if v.Type().Implements(marshalerType){
+		return v.Interface().(Marshaler), true
+	}
+	if v.CanAddr() && reflect.PtrTo(v.Type()).Implements(marshalerType){
+		return v.Addr().Interface().(Marshaler), true
+	}
+	return nil, false
+}
+
+//写入已经编码好的值，空的编码会破坏外层的list或dict，所以视为错误
+func writeRaw(bw *bufio.Writer, data []byte) (int, error){
+	if len(data) == 0{
+		return 0, ErrIvd
+	}
+	return bw.Write(data)
 }
 
-func marshalValue(w io.Writer, v reflect.Value) int{
+func marshalValue(bw *bufio.Writer, v reflect.Value) (int, error){
 	len := 0
+	if !v.IsValid(){
+		return 0, ErrNil
+	}
+	//RawMessage已经是bencode编码，直接写出
+	if v.Type() == rawMessageType{
+		return writeRaw(bw, v.Bytes())
+	}
+	if v.Type() == bobjectType{
+		o := v.Interface().(Bobject)
+		return o.encode(bw)
+	}
+	if v.Type() == bigIntType{
+		b := v.Interface().(big.Int)
+		return encodeDigits(bw, b.String()), nil
+	}
+	if m, ok := asMarshaler(v); ok{
+		data, err := m.MarshalBencode()
+		if err != nil{
+			return 0, err
+		}
+		return writeRaw(bw, data)
+	}
 	switch  v.Kind() {
 	case reflect.String:
-		len += EncodeString(w, v.String())
-	case reflect.Int:
-		len += EncodeInt(w, int(v.Int()))
+		len += encodeString(bw, v.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		len += encodeInt(bw, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		len += encodeDigits(bw, strconv.FormatUint(v.Uint(), 10))
+	case reflect.Bool:
+		var val int64
+		if v.Bool(){
+			val = 1
+		}
+		len += encodeInt(bw, val)
 	case reflect.Slice:
-		len += marshalList(w, v)
+		if v.Type().Elem().Kind() == reflect.Uint8{
+			len += encodeString(bw, string(v.Bytes()))
+			break
+		}
+		return marshalList(bw, v)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8{
+			//数组不一定可寻址，逐个拷贝出来
+			buf := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(buf), v)
+			len += encodeString(bw, string(buf))
+			break
+		}
+		return marshalList(bw, v)
+	case reflect.Map:
+		return marshalMap(bw, v)
 	case reflect.Struct:
-		len += marshalDict(w, v)
+		return marshalDict(bw, v)
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil(){
+			return 0, ErrNil
+		}
+		return marshalValue(bw, v.Elem())
+	default:
+		return 0, fmt.Errorf("%w: unsupported type %v", ErrTyp, v.Type())
+	}
+	return len, nil
+}
+
+//nil的指针和interface没有对应的bencode值，dict中直接省略
+func isNilValue(v reflect.Value) bool{
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil() || isNilValue(v.Elem())
 	}
-	return len
+	return !v.IsValid()
 }
 
-func marshalList(w io.Writer, vl reflect.Value) int{
+func marshalList(bw *bufio.Writer, vl reflect.Value) (int, error){
 	len := 2
-	w.Write([]byte{'l'})
+	bw.WriteByte('l')
 	for i := 0; i < vl.Len(); i++{
+		//省略nil会改变后面元素的下标
 		ev := vl.Index(i)
-		len += marshalValue(w, ev)
+		if isNilValue(ev){
+			return 0, fmt.Errorf("%w: list element %d", ErrNil, i)
+		}
+		n, err := marshalValue(bw, ev)
+		if err != nil{
+			return 0, err
+		}
+		len += n
+	}
+	bw.WriteByte('e')
+	return len, nil
+}
+
+//struct的字段和它对应的key
+type dictField struct {
+	key		string
+	value	reflect.Value
+}
+
+func marshalDict(bw *bufio.Writer, vd reflect.Value) (int, error){
+	sf := typeFields(vd.Type())
+	fields := make([]dictField, 0, len(sf.fields))
+	for _, f := range sf.fields{
+		fv := vd.Field(f.index)			//value
+		if f.omitEmpty && isEmptyValue(fv){
+			continue
+		}
+		fields = append(fields, dictField{f.key, fv})
+	}
+	//把解码时收集到的未知key写回，和字段重名的key以字段为准
+	if sf.unknown >= 0{
+		iter := vd.Field(sf.unknown).MapRange()
+		for iter.Next(){
+			if _, ok := sf.byKey[iter.Key().String()]; !ok{
+				fields = append(fields, dictField{iter.Key().String(), iter.Value()})
+			}
+		}
 	}
-	w.Write([]byte{'e'})
-	return len
+	return writeDict(bw, fields)
 }
 
-func marshalDict(w io.Writer, vd reflect.Value) int{
+func marshalMap(bw *bufio.Writer, vm reflect.Value) (int, error){
+	//bencode的key只能是string
+	if vm.Type().Key().Kind() != reflect.String{
+		return 0, fmt.Errorf("%w: unsupported map key type %v", ErrTyp, vm.Type().Key())
+	}
+	fields := make([]dictField, 0, vm.Len())
+	iter := vm.MapRange()
+	for iter.Next(){
+		fields = append(fields, dictField{iter.Key().String(), iter.Value()})
+	}
+	return writeDict(bw, fields)
+}
+
+func writeDict(bw *bufio.Writer, fields []dictField) (int, error){
 	len := 2
-	w.Write([]byte{'d'})
-	for i := 0; i < vd.NumField(); i++{
-		fv := vd.Field(i)			//value
-		ft := vd.Type().Field(i)
-		key := ft.Tag.Get("bencode")
-		if key == ""{
-			key = strings.ToLower(ft.Name)
-		}
-		len += EncodeString(w, key)
-		len += marshalValue(w, fv)
-	}
-	w.Write([]byte{'e'})
-	return len
-}
\ No newline at end of file
+	bw.WriteByte('d')
+	//字段的声明顺序不一定是字典序，按key排序后再写入，保证编码结果唯一
+	sort.Slice(fields, func(i, j int) bool{
+		return fields[i].key < fields[j].key
+	})
+	for _, f := range fields{
+		if isNilValue(f.value){
+			continue
+		}
+		len += encodeString(bw, f.key)
+		n, err := marshalValue(bw, f.value)
+		if err != nil{
+			return 0, err
+		}
+		len += n
+	}
+	bw.WriteByte('e')
+	return len, nil
+}
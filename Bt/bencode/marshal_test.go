@@ -0,0 +1,148 @@
+package bencode
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type allTypes struct {
+	I64		int64				`bencode:"i64"`
+	U32		uint32				`bencode:"u32"`
+	U8		uint8				`bencode:"u8"`
+	Flag	bool				`bencode:"flag"`
+	Bytes	[]byte				`bencode:"bytes"`
+	Hash	[4]byte				`bencode:"hash"`
+	Ints	[2]int				`bencode:"ints"`
+	Map		map[string]int		`bencode:"map"`
+	Ptr		*user				`bencode:"ptr"`
+	NilPtr	*user				`bencode:"nilptr"`
+	Any		interface{}			`bencode:"any"`
+	Mixed	[]interface{}		`bencode:"mixed"`
+	hidden	int
+}
+
+func TestMarshalAllTypes(t *testing.T) {
+	s := allTypes{
+		I64:   -1 << 40,
+		U32:   4000000000,
+		U8:    255,
+		Flag:  true,
+		Bytes: []byte{0, 1, 0xff},
+		Hash:  [4]byte{'a', 'b', 'c', 'd'},
+		Ints:  [2]int{1, 2},
+		Map:   map[string]int{"z": 26, "a": 1},
+		Ptr:   &user{"archer", 29},
+		Any:   "x",
+		Mixed: []interface{}{1, "s", []interface{}{2}},
+	}
+	out := new(bytes.Buffer)
+	wlen, err := Marshal(out, &s)
+	assert.Equal(t, nil, err)
+	expect := "d3:any1:x5:bytes3:\x00\x01\xff4:flagi1e4:hash4:abcd3:i64i-1099511627776e4:intsli1ei2ee" +
+		"3:mapd1:ai1e1:zi26ee5:mixedli1e1:sli2eee3:ptrd3:agei29e4:name6:archere" +
+		"3:u32i4000000000e2:u8i255ee"
+	assert.Equal(t, expect, out.String())
+	assert.Equal(t, len(expect), wlen)
+
+	//interface{}中的int解码为int64
+	s.Mixed = []interface{}{int64(1), "s", []interface{}{int64(2)}}
+	got := new(allTypes)
+	err = Unmarshal(bytes.NewBufferString(expect), got)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, s, *got)
+}
+
+func TestUnmarshalInterface(t *testing.T) {
+	var v interface{}
+	err := Unmarshal(bytes.NewBufferString("d1:ali1e1:be1:bd1:ci2eee"), &v)
+	assert.Equal(t, nil, err)
+	expect := map[string]interface{}{
+		"a": []interface{}{int64(1), "b"},
+		"b": map[string]interface{}{"c": int64(2)},
+	}
+	assert.Equal(t, expect, v)
+
+	var m map[string]interface{}
+	err = Unmarshal(bytes.NewBufferString("d1:ai1e1:b1:xe"), &m)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, map[string]interface{}{"a": int64(1), "b": "x"}, m)
+
+	var s string
+	err = Unmarshal(bytes.NewBufferString("3:abc"), &s)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "abc", s)
+}
+
+func TestUnmarshalRange(t *testing.T) {
+	var u8 uint8
+	assert.ErrorIs(t, Unmarshal(bytes.NewBufferString("i256e"), &u8), ErrRng)
+	var u uint
+	assert.ErrorIs(t, Unmarshal(bytes.NewBufferString("i-1e"), &u), ErrRng)
+	var h [4]byte
+	assert.ErrorIs(t, Unmarshal(bytes.NewBufferString("3:abc"), &h), ErrTyp)
+	var list []int
+	assert.ErrorIs(t, Unmarshal(bytes.NewBufferString("li1e1:ae"), &list), ErrTyp)
+}
+
+//以"v:"为前缀的string
+type prefixed string
+
+func (p prefixed) MarshalBencode() ([]byte, error) {
+	out := new(bytes.Buffer)
+	EncodeString(out, "v:"+string(p))
+	return out.Bytes(), nil
+}
+
+func (p *prefixed) UnmarshalBencode(data []byte) error {
+	str, err := DecodeString(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	*p = prefixed(str[2:])
+	return nil
+}
+
+type withMarshaler struct {
+	Val		prefixed	`bencode:"val"`
+	Ptr		*prefixed	`bencode:"ptr"`
+	List	[]prefixed	`bencode:"list"`
+}
+
+func TestMarshaler(t *testing.T) {
+	p := prefixed("b")
+	s := withMarshaler{Val: "a", Ptr: &p, List: []prefixed{"c"}}
+	out := new(bytes.Buffer)
+	Marshal(out, s)
+	expect := "d4:listl3:v:ce3:ptr3:v:b3:val3:v:ae"
+	assert.Equal(t, expect, out.String())
+
+	got := new(withMarshaler)
+	assert.Equal(t, nil, Unmarshal(bytes.NewBufferString(expect), got))
+	assert.Equal(t, s, *got)
+
+	err := Unmarshal(bytes.NewBufferString("d3:vali1ee"), got)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestMarshalNil(t *testing.T) {
+	out := new(bytes.Buffer)
+	_, err := Marshal(out, nil)
+	assert.ErrorIs(t, err, ErrNil)
+	_, err = Marshal(out, (*user)(nil))
+	assert.ErrorIs(t, err, ErrNil)
+	//list中省略nil会改变后面元素的下标
+	_, err = Marshal(out, []*int{nil, nil})
+	assert.ErrorIs(t, err, ErrNil)
+	var ip *int
+	_, err = Marshal(out, []interface{}{1, ip})
+	assert.ErrorIs(t, err, ErrNil)
+	assert.Equal(t, 0, out.Len())
+
+	//dict中的nil省略对应的key
+	n, err := Marshal(out, map[string]interface{}{"a": nil, "b": 1})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "d1:bi1ee", out.String())
+	assert.Equal(t, out.Len(), n)
+}
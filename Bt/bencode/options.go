@@ -0,0 +1,77 @@
+package bencode
+
+import (
+	"io"
+)
+
+//默认的最大嵌套层数，递归解析时防止栈被耗尽
+const DefaultMaxDepth = 512
+
+//解码选项，零值即默认的宽松模式
+//解码不可信的数据(tracker响应、peer的扩展消息)时，应设置下面的资源限制，超出时返回*LimitError
+type DecoderOptions struct {
+	//严格模式：拒绝非规范的编码(int和长度的前导0、-0，未排序或重复的dict key)，
+	//Unmarshal时还会拒绝值后面多余的数据
+	Strict bool
+	//dict中有struct没有对应字段的key时返回错误(struct有unknown字段时仍然收集到该字段中)
+	DisallowUnknownFields bool
+	//超出int64范围的int解码为*big.Int，否则返回ErrRng
+	BigInt bool
+	//Unmarshal遇到类型不匹配时不立即返回，而是跳过该值继续赋值，最后返回UnmarshalErrors
+	CollectErrors bool
+
+	//list和dict的最大嵌套层数，0表示DefaultMaxDepth
+	MaxDepth int
+	//单个string的最大长度，0表示不限制
+	MaxStringLen int
+	//单个值(包括它的所有子值)的最大编码长度，0表示不限制
+	MaxBytes int64
+	//单个list或dict的最大元素个数，0表示不限制
+	MaxEntries int
+}
+
+func (opts DecoderOptions) maxDepth() int{
+	if opts.MaxDepth <= 0{
+		return DefaultMaxDepth
+	}
+	return opts.MaxDepth
+}
+
+//按opts解析r中的一个值
+func (opts DecoderOptions) Parse(r io.Reader) (*Bobject, error){
+	return newParser(r, opts).parse()
+}
+
+//按opts解析data中的一个值，string值直接引用data
+func (opts DecoderOptions) ParseBytes(data []byte) (*Bobject, error){
+	return newBytesParser(data, opts).parse()
+}
+
+//按opts把r中的数据解析后赋值给s
+func (opts DecoderOptions) Unmarshal(r io.Reader, s interface{}) error{
+	//每个Bobject记录自己的原始编码，供RawMessage使用
+	return opts.unmarshal(newParser(r, opts), s)
+}
+
+//按opts把data解析后赋值给s，[]byte和RawMessage类型的值直接引用data
+func (opts DecoderOptions) UnmarshalBytes(data []byte, s interface{}) error{
+	return opts.unmarshal(newBytesParser(data, opts), s)
+}
+
+func (opts DecoderOptions) unmarshal(p *parser, s interface{}) error{
+	obj, err := p.parseRaw()
+	if err != nil{
+		return err
+	}
+	if opts.Strict{
+		if _, err := p.peek(); err != io.EOF{
+			return &SyntaxError{p.off, ErrTrl}
+		}
+	}
+	return unmarshal(obj, s, opts)
+}
+
+//创建一个按opts解码的Decoder
+func (opts DecoderOptions) NewDecoder(r io.Reader) *Decoder{
+	return &Decoder{p: newParser(r, opts), opts: opts}
+}
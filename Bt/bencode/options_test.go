@@ -0,0 +1,71 @@
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func assertLimitError(t *testing.T, err error, expect error) {
+	var le *LimitError
+	if assert.True(t, errors.As(err, &le), "%v", err) {
+		assert.ErrorIs(t, le, expect)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	deep := strings.Repeat("l", 10) + strings.Repeat("e", 10)
+	_, err := DecoderOptions{MaxDepth: 10}.Parse(bytes.NewBufferString(deep))
+	assert.Equal(t, nil, err)
+	_, err = DecoderOptions{MaxDepth: 9}.Parse(bytes.NewBufferString(deep))
+	assertLimitError(t, err, ErrDepth)
+
+	_, err = Parse(bytes.NewBufferString(strings.Repeat("l", DefaultMaxDepth + 1)))
+	assertLimitError(t, err, ErrDepth)
+
+	_, err = DecoderOptions{MaxStringLen: 3}.Parse(bytes.NewBufferString("4:abcd"))
+	assertLimitError(t, err, ErrStrLen)
+
+	_, err = DecoderOptions{MaxBytes: 8}.Parse(bytes.NewBufferString("li1ei2ee"))
+	assert.Equal(t, nil, err)
+	_, err = DecoderOptions{MaxBytes: 7}.Parse(bytes.NewBufferString("li1ei2ee"))
+	assertLimitError(t, err, ErrBytes)
+	_, err = DecoderOptions{MaxBytes: 7}.Parse(bytes.NewBufferString("10:abcdefghij"))
+	assertLimitError(t, err, ErrBytes)
+
+	_, err = DecoderOptions{MaxEntries: 2}.Parse(bytes.NewBufferString("li1ei2ei3ee"))
+	assertLimitError(t, err, ErrEntries)
+	_, err = DecoderOptions{MaxEntries: 1}.Parse(bytes.NewBufferString("d1:ai1e1:bi2ee"))
+	assertLimitError(t, err, ErrEntries)
+
+	var v interface{}
+	err = DecoderOptions{MaxEntries: 1}.Unmarshal(bytes.NewBufferString("li1ei2ee"), &v)
+	assertLimitError(t, err, ErrEntries)
+}
+
+func TestLimitsStream(t *testing.T) {
+	//MaxBytes对流中的每个值单独计算
+	opts := DecoderOptions{MaxBytes: 3, MaxDepth: 1}
+	dec := opts.NewDecoder(bytes.NewBufferString("i1ei2ei3e"))
+	var i int
+	for n := 1; n <= 3; n++ {
+		assert.Equal(t, nil, dec.Decode(&i))
+		assert.Equal(t, n, i)
+	}
+
+	dec = opts.NewDecoder(bytes.NewBufferString("lle"))
+	_, err := dec.Token()
+	assert.Equal(t, nil, err)
+	_, err = dec.Token()
+	assertLimitError(t, err, ErrDepth)
+}
+
+func TestFakeStringLength(t *testing.T) {
+	//长度前缀远大于实际数据时，应返回截断错误而不是分配巨大的内存
+	_, err := Parse(bytes.NewBufferString("999999999999:abc"))
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
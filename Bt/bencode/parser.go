@@ -2,35 +2,94 @@ package bencode
 
 import (
 	"bufio"
+	"bytes"
 	"io"
+	"math/big"
+	"strconv"
 )
-//Bencode -> Bobejct
-func Parse(r io.Reader) (*Bobject, error){
+
+//解析状态：记录已经取出的字节数，用于报告错误位置和截取原始编码
+//br为nil时直接从data中解析，string和原始编码都是data的子切片，不做拷贝
+type parser struct {
+	br		*bufio.Reader
+	data	[]byte
+	opts	DecoderOptions
+	off		int64	//已经取出的字节数
+	record	bool	//是否把取出的字节记录到buf中
+	base	int64	//开始记录时的off
+	buf		[]byte
+	depth	int		//当前的嵌套层数
+	start	int64	//当前最外层值开始时的off，用于MaxBytes
+	unique	bool	//非严格模式下也拒绝重复的dict key，key可以无序(Canonicalize使用)
+}
+
+//超过这个长度的string按实际读到的数据逐步分配内存
+const readChunk = 64 * 1024
+
+func newParser(r io.Reader, opts DecoderOptions) *parser{
 	br, ok := r.(*bufio.Reader)
 	if !ok{
 		br = bufio.NewReader(r)
 	}
-	//从缓冲中，得到长度为1的byte切片，但不取出，不会破坏文件完整性
-	b, err := br.Peek(1)
+	return &parser{br: br, opts: opts}
+}
+
+func newBytesParser(data []byte, opts DecoderOptions) *parser{
+	return &parser{data: data, opts: opts}
+}
+
+//Bencode -> Bobejct
+func Parse(r io.Reader) (*Bobject, error){
+	return DecoderOptions{}.Parse(r)
+}
+
+//从data中解析一个值，得到的string值和原始编码直接引用data，使用结果期间不能修改data
+func ParseBytes(data []byte) (*Bobject, error){
+	return DecoderOptions{}.ParseBytes(data)
+}
+
+//解析一个值，每个Bobject都会记录自己的原始编码
+func (p *parser) parseRaw() (*Bobject, error){
+	p.record = true
+	p.base = p.off
+	p.buf = nil
+	defer func(){
+		p.record = false
+		p.buf = nil
+	}()
+	return p.parse()
+}
+
+func (p *parser) parse() (*Bobject, error){
+	//从缓冲中，得到一个byte，但不取出，不会破坏文件完整性
+	b, err := p.peek()
 	if err != nil{
 		return nil, err
 	}
 
 	var obj Bobject
+	start := p.off
+	if p.depth == 0{
+		p.start = start
+	}
 
 	switch  {
 	//string
-	case b[0] >= '0' && b[0] <= '9':
-		val, err := DecodeString(br)
+	case b >= '0' && b <= '9':
+		val, err := p.decodeBytes()
 		if err != nil{
 			return nil, err
 		}
 		obj.btype = Bstr
-		obj.bval = val
+		if p.br == nil{
+			obj.bval = val		//引用data，不拷贝
+		}else{
+			obj.bval = string(val)
+		}
 
 	//int
-	case b[0] == 'i':
-		val, err := DecodeInt(br)
+	case b == 'i':
+		val, err := p.decodeInt()
 		if err != nil{
 			return nil, err
 		}
@@ -38,51 +97,350 @@ func Parse(r io.Reader) (*Bobject, error){
 		obj.bval = val
 
 	//list
-	case b[0] == 'l':
-		br.ReadByte()		//先取出'l', 'l'后是要转换的数据
+	case b == 'l':
+		err := p.enter()
+		if err != nil{
+			return nil, err
+		}
+		defer p.leave()
+		//先取出'l', 'l'后是要转换的数据
+		if _, err := p.readByte(); err != nil{
+			return nil, err
+		}
 		var list []*Bobject
 
 		for{
 			//当循环到'e'时，代表list全部转化完成
-			p, _ := br.Peek(1)
-			if p[0] == 'e'{
-				br.ReadByte()
+			c, err := p.peek()
+			if err != nil{
+				return nil, p.unexpected(err)
+			}
+			if c == 'e'{
+				if _, err := p.readByte(); err != nil{
+					return nil, err
+				}
 				break
 			}
 
-			objs, err := Parse(br)
-			if err != nil{
+			if err := p.checkEntries(len(list)); err != nil{
 				return nil, err
 			}
+			objs, err := p.parse()
+			if err != nil{
+				return nil, p.unexpected(err)
+			}
 			list = append(list, objs)
 		}
 		obj.btype = Blist
 		obj.bval = list
-	case b[0] == 'd':
-		br.ReadByte()		//取出'd'
+	case b == 'd':
+		err := p.enter()
+		if err != nil{
+			return nil, err
+		}
+		defer p.leave()
+		//取出'd'
+		if _, err := p.readByte(); err != nil{
+			return nil, err
+		}
 		dict := make(map[string]*Bobject)
+		prev := ""
 		for {
-			p, _ := br.Peek(1)
-			if p[0] == 'e'{
-				br.ReadByte()
+			c, err := p.peek()
+			if err != nil{
+				return nil, p.unexpected(err)
+			}
+			if c == 'e'{
+				if _, err := p.readByte(); err != nil{
+					return nil, err
+				}
 				break
 			}
 
-			key, err := DecodeString(br)
-			if err != nil{
+			if err := p.checkEntries(len(dict)); err != nil{
 				return nil, err
 			}
+			keyOff := p.off
+			key, err := p.decodeString()
+			if err != nil{
+				return nil, p.unexpected(err)
+			}
+			//严格模式下，key必须按字典序排列且不能重复
+			if p.opts.Strict && len(dict) > 0{
+				if key == prev{
+					return nil, &SyntaxError{keyOff, ErrDup}
+				}
+				if key < prev{
+					return nil, &SyntaxError{keyOff, ErrSrt}
+				}
+			}
+			if p.unique{
+				if _, ok := dict[key]; ok{
+					return nil, &SyntaxError{keyOff, ErrDup}
+				}
+			}
+			prev = key
 
-			val, err := Parse(br)
+			val, err := p.parse()
 			if err != nil{
-				return nil, err
+				return nil, p.unexpected(err)
 			}
 			dict[key] = val
 		}
 		obj.btype = Bdict
 		obj.bval = dict
 	default:
-		return nil, ErrIvd
+		return nil, &SyntaxError{start, ErrIvd}
+	}
+	if p.br == nil{
+		obj.raw = p.data[start : p.off : p.off]
+	}else if p.record{
+		obj.raw = p.buf[start - p.base : p.off - p.base]
 	}
 	return &obj, nil
-}
\ No newline at end of file
+}
+
+//进入一层list或dict
+func (p *parser) enter() error{
+	if p.depth >= p.opts.maxDepth(){
+		return &LimitError{p.off, ErrDepth}
+	}
+	p.depth++
+	return nil
+}
+
+func (p *parser) leave(){
+	p.depth--
+}
+
+//list或dict中已经有n个元素时，检查能否再加一个
+func (p *parser) checkEntries(n int) error{
+	if p.opts.MaxEntries > 0 && n >= p.opts.MaxEntries{
+		return &LimitError{p.off, ErrEntries}
+	}
+	return nil
+}
+
+//检查当前值能否再取出n个byte
+func (p *parser) checkBytes(n int) error{
+	if p.opts.MaxBytes > 0 && p.off - p.start + int64(n) > p.opts.MaxBytes{
+		return &LimitError{p.off, ErrBytes}
+	}
+	return nil
+}
+
+//值还没有读完就遇到了EOF，说明数据被截断了
+func (p *parser) unexpected(err error) error{
+	if err == io.EOF{
+		return &SyntaxError{p.off, io.ErrUnexpectedEOF}
+	}
+	return err
+}
+
+func (p *parser) peek() (byte, error){
+	if p.br == nil{
+		if p.off >= int64(len(p.data)){
+			return 0, io.EOF
+		}
+		return p.data[p.off], nil
+	}
+	b, err := p.br.Peek(1)
+	if err != nil{
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (p *parser) readByte() (byte, error){
+	if err := p.checkBytes(1); err != nil{
+		return 0, err
+	}
+	if p.br == nil{
+		b, err := p.peek()
+		if err != nil{
+			return 0, err
+		}
+		p.off++
+		return b, nil
+	}
+	b, err := p.br.ReadByte()
+	if err != nil{
+		return 0, err
+	}
+	p.off++
+	if p.record{
+		p.buf = append(p.buf, b)
+	}
+	return b, nil
+}
+
+//取出n个byte
+func (p *parser) readFull(n int) ([]byte, error){
+	if err := p.checkBytes(n); err != nil{
+		return nil, err
+	}
+	if p.br == nil{
+		end := p.off + int64(n)
+		if end > int64(len(p.data)){
+			p.off = int64(len(p.data))
+			return nil, p.unexpected(io.EOF)
+		}
+		buf := p.data[p.off : end : end]
+		p.off = end
+		return buf, nil
+	}
+	var buf []byte
+	var err error
+	if n <= readChunk{
+		buf = make([]byte, n)
+		var m int
+		m, err = io.ReadFull(p.br, buf)
+		buf = buf[:m]
+	}else{
+		//长度前缀可能是伪造的，按实际读到的数据逐步扩容，而不是直接分配n个byte
+		w := bytes.NewBuffer(make([]byte, 0, readChunk))
+		_, err = io.CopyN(w, p.br, int64(n))
+		buf = w.Bytes()
+	}
+	p.off += int64(len(buf))
+	if p.record{
+		p.buf = append(p.buf, buf...)
+	}
+	if err != nil{
+		return nil, p.unexpected(io.EOF)
+	}
+	return buf, nil
+}
+
+//取出到delim为止的所有byte，返回值不包含delim
+func (p *parser) readUntil(delim byte) ([]byte, error){
+	if p.br == nil{
+		idx := bytes.IndexByte(p.data[p.off:], delim)
+		if idx < 0{
+			p.off = int64(len(p.data))
+			return nil, p.unexpected(io.EOF)
+		}
+		if err := p.checkBytes(idx + 1); err != nil{
+			return nil, err
+		}
+		buf := p.data[p.off : p.off + int64(idx)]
+		p.off += int64(idx) + 1
+		return buf, nil
+	}
+	var buf []byte
+	for{
+		b, err := p.readByte()
+		if err != nil{
+			return nil, p.unexpected(err)
+		}
+		if b == delim{
+			return buf, nil
+		}
+		buf = append(buf, b)
+	}
+}
+
+/*
+	int解码过程：
+		1. 取出'i'
+		2. 取出'e'之前的部分，校验并转为十进制数
+*/
+func (p *parser) decodeInt() (BValue, error){
+	start := p.off
+	b, err := p.readByte()
+	if err != nil{
+		return nil, p.unexpected(err)
+	}
+	if b != 'i'{
+		return nil, &SyntaxError{start, ErrEpI}
+	}
+	digits, err := p.readUntil('e')
+	if err != nil{
+		return nil, err
+	}
+
+	str := string(digits)
+	num := str
+	if len(num) > 0 && num[0] == '-'{
+		num = num[1:]
+	}
+	if !isDigits(num){
+		return nil, &SyntaxError{start + 1, ErrNum}
+	}
+	if p.opts.Strict{
+		if str == "-0" || (len(num) > 1 && num[0] == '0'){
+			return nil, &SyntaxError{start + 1, ErrZro}
+		}
+	}
+	val, err := strconv.ParseInt(str, 10, 64)
+	if err == nil{
+		return val, nil
+	}
+	//已经校验过格式，出错只可能是超出了int64的范围
+	if !p.opts.BigInt{
+		return nil, &SyntaxError{start + 1, ErrRng}
+	}
+	bigVal, _ := new(big.Int).SetString(str, 10)
+	return bigVal, nil
+}
+
+func (p *parser) decodeString() (string, error){
+	buf, err := p.decodeBytes()
+	if err != nil{
+		return "", err
+	}
+	return string(buf), nil
+}
+
+/*
+	string解码过程：
+		1. 取出':'之前的长度，校验并转为十进制数
+		2. 取出长度为num的字符串
+*/
+func (p *parser) decodeBytes() ([]byte, error){
+	start := p.off
+	var digits []byte
+	for{
+		b, err := p.readByte()
+		if err != nil{
+			return nil, p.unexpected(err)
+		}
+		if b == ':'{
+			break
+		}
+		if b < '0' || b > '9'{
+			if len(digits) == 0{
+				return nil, &SyntaxError{start, ErrNum}
+			}
+			return nil, &SyntaxError{p.off - 1, ErrCol}
+		}
+		digits = append(digits, b)
+	}
+	if len(digits) == 0{
+		return nil, &SyntaxError{start, ErrNum}
+	}
+	if p.opts.Strict && len(digits) > 1 && digits[0] == '0'{
+		return nil, &SyntaxError{start, ErrZro}
+	}
+	num, err := strconv.Atoi(string(digits))
+	if err != nil{
+		return nil, &SyntaxError{start, ErrNum}
+	}
+	if p.opts.MaxStringLen > 0 && num > p.opts.MaxStringLen{
+		return nil, &LimitError{start, ErrStrLen}
+	}
+
+	return p.readFull(num)
+}
+
+func isDigits(s string) bool{
+	if s == ""{
+		return false
+	}
+	for i := 0; i < len(s); i++{
+		if s[i] < '0' || s[i] > '9'{
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func assertSyntaxError(t *testing.T, err error, offset int64, expect error) {
+	var se *SyntaxError
+	if assert.True(t, errors.As(err, &se), "%v", err) {
+		assert.Equal(t, offset, se.Offset)
+		assert.ErrorIs(t, se, expect)
+	}
+}
+
+func TestParseTruncated(t *testing.T) {
+	for _, in := range []string{"l", "li1e", "d", "d1:a", "d1:ai1e", "5:abc", "i12", "d1:ali1e"} {
+		_, err := Parse(bytes.NewBufferString(in))
+		assertSyntaxError(t, err, int64(len(in)), io.ErrUnexpectedEOF)
+	}
+	_, err := Parse(bytes.NewBufferString(""))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := Parse(bytes.NewBufferString("li1ex"))
+	assertSyntaxError(t, err, 4, ErrIvd)
+	_, err = Parse(bytes.NewBufferString("i1x2e"))
+	assertSyntaxError(t, err, 1, ErrNum)
+	_, err = Parse(bytes.NewBufferString("i-e"))
+	assertSyntaxError(t, err, 1, ErrNum)
+	_, err = Parse(bytes.NewBufferString("3x:abc"))
+	assertSyntaxError(t, err, 1, ErrCol)
+	_, err = Parse(bytes.NewBufferString("di1ei2ee"))
+	assertSyntaxError(t, err, 1, ErrNum)
+}
+
+func TestParseStrict(t *testing.T) {
+	lenient := DecoderOptions{}
+	strict := DecoderOptions{Strict: true}
+	cases := []struct {
+		in		string
+		offset	int64
+		err		error
+	}{
+		{"i03e", 1, ErrZro},
+		{"i-0e", 1, ErrZro},
+		{"i-03e", 1, ErrZro},
+		{"03:abc", 0, ErrZro},
+		{"d1:bi1e1:ai2ee", 7, ErrSrt},
+		{"d1:ai1e1:ai2ee", 7, ErrDup},
+		{"ld1:ai1e1:ai2eee", 8, ErrDup},
+	}
+	for _, c := range cases {
+		_, err := lenient.Parse(bytes.NewBufferString(c.in))
+		assert.Equal(t, nil, err, c.in)
+		_, err = strict.Parse(bytes.NewBufferString(c.in))
+		assertSyntaxError(t, err, c.offset, c.err)
+	}
+
+	o, err := strict.Parse(bytes.NewBufferString("d1:ai0e1:bi-3e1:c0:e"))
+	assert.Equal(t, nil, err)
+	dict, _ := o.Dict()
+	assert.Equal(t, 3, len(dict))
+
+	var list []int
+	err = lenient.Unmarshal(bytes.NewBufferString("li1eei2e"), &list)
+	assert.Equal(t, nil, err)
+	err = strict.Unmarshal(bytes.NewBufferString("li1eei2e"), &list)
+	assertSyntaxError(t, err, 5, ErrTrl)
+}
@@ -0,0 +1,77 @@
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type tfile struct {
+	Length	int			`bencode:"length"`
+	Path	[]string	`bencode:"path"`
+}
+
+type tinfo struct {
+	Name	string		`bencode:"name"`
+	Files	[]tfile		`bencode:"files"`
+}
+
+type tmeta struct {
+	Announce	string	`bencode:"announce"`
+	Info		tinfo	`bencode:"info"`
+}
+
+func TestUnmarshalTypeError(t *testing.T) {
+	in := "d8:announce1:a4:infod5:filesld6:lengthi1e4:pathl1:aeed6:length1:xeee4:name1:nee"
+	m := new(tmeta)
+	err := Unmarshal(bytes.NewBufferString(in), m)
+	var te *UnmarshalTypeError
+	assert.True(t, errors.As(err, &te))
+	assert.Equal(t, "info.files[1].length", te.Path)
+	assert.Equal(t, "string", te.Value)
+	assert.Equal(t, reflect.TypeOf(0), te.Type)
+	assert.ErrorIs(t, err, ErrTyp)
+	assert.Equal(t, "bencode: cannot unmarshal string into field info.files[1].length of type int", err.Error())
+
+	//list中嵌套的错误
+	var lists [][]int
+	err = Unmarshal(bytes.NewBufferString("lli1eeli2eleee"), &lists)
+	assert.True(t, errors.As(err, &te))
+	assert.Equal(t, "[1][1]", te.Path)
+	assert.Equal(t, "list", te.Value)
+
+	//map的key也是路径的一部分
+	var mm map[string]map[string]uint8
+	err = Unmarshal(bytes.NewBufferString("d1:ad1:bi256eee"), &mm)
+	assert.True(t, errors.As(err, &te))
+	assert.Equal(t, "a.b", te.Path)
+	assert.Equal(t, "int 256", te.Value)
+	assert.ErrorIs(t, err, ErrRng)
+
+	var s string
+	err = Unmarshal(bytes.NewBufferString("le"), &s)
+	assert.Equal(t, "bencode: cannot unmarshal list into Go value of type string", err.Error())
+}
+
+func TestCollectErrors(t *testing.T) {
+	in := "d8:announcei1e4:infod5:filesld6:lengthi1e4:pathl1:aeed6:length1:x4:pathli2eeee4:name1:nee"
+	m := new(tmeta)
+	opts := DecoderOptions{CollectErrors: true}
+	err := opts.Unmarshal(bytes.NewBufferString(in), m)
+	var errs UnmarshalErrors
+	assert.True(t, errors.As(err, &errs))
+	paths := make([]string, len(errs))
+	for i, e := range errs {
+		paths[i] = e.Path
+	}
+	assert.Equal(t, []string{"announce", "info.files[1].length", "info.files[1].path[0]"}, paths)
+	assert.ErrorIs(t, err, ErrTyp)
+
+	//其他字段照常赋值
+	assert.Equal(t, "n", m.Info.Name)
+	assert.Equal(t, 2, len(m.Info.Files))
+	assert.Equal(t, []string{"a"}, m.Info.Files[0].Path)
+}
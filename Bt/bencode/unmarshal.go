@@ -1,188 +1,359 @@
 package bencode
 
 import (
+	"bytes"
 	"errors"
 	"io"
+	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
+/*
+	Bencode -> Go类型：
+		string	-> string、[]byte、[N]byte(长度必须一致)
+		int		-> int*、uint*、big.Int、bool(非0为true)
+		list	-> slice、array
+		dict	-> struct、key为string的map
+		指针会自动分配；interface{}按值的类型填入string、int64(或*big.Int)、[]interface{}、map[string]interface{}
+	实现了Unmarshaler的类型由自己解码
+	类型不匹配或int超出范围时返回*UnmarshalTypeError，其中的Path指出出错的字段
+*/
 func Unmarshal(r io.Reader, s interface{}) error{
 	//从io中读入,并把内容解析成Bobject
-	obj, err := Parse(r)
-	if err != nil{
-		return err
-	}
+	return DecoderOptions{}.Unmarshal(r, s)
+}
+
+//从data中解析并赋值给s，不经过bufio，[]byte和RawMessage类型的值直接引用data，使用期间不能修改data
+func UnmarshalBytes(data []byte, s interface{}) error{
+	return DecoderOptions{}.UnmarshalBytes(data, s)
+}
+
+//赋值过程中的状态
+type decodeState struct {
+	opts	DecoderOptions
+	path	[]string	//当前值在最外层值中的位置，dict的key或"[i]"
+	errs	UnmarshalErrors
+}
 
-	//
+//把解析好的Bobject按opts赋值给s指向的值
+func unmarshal(obj *Bobject, s interface{}, opts DecoderOptions) error{
 	p := reflect.ValueOf(s)
-	//校验s是不是指针类型，因为需要对指向的Slice或Struct进行值修改，必须为指针
-	if p.Kind() != reflect.Ptr{
+	//校验s是不是指针类型，因为需要对指向的值进行修改，必须为非nil的指针
+	if p.Kind() != reflect.Ptr || p.IsNil(){
 		return errors.New("dest must be a pointer")
 	}
+	d := &decodeState{opts: opts}
+	if err := d.unmarshalValue(p.Elem(), obj); err != nil{
+		return err
+	}
+	if len(d.errs) > 0{
+		return d.errs
+	}
+	return nil
+}
 
-	switch obj.btype {
-	case Blist:
-		//取得obj的val
-		list, _ := obj.List()
-		//因为传入的slice可能为空或者size、cap不同，所以这里创建了一个新的slice
-		l := reflect.MakeSlice(p.Elem().Type(), len(list), len(list))
-		//将传入的指针指向新创建的slice
-		p.Elem().Set(l)
-		err = unmarshalList(p, list)
-		if err != nil{
-			return err
-		}
-	case Bdict:
-		dict, _ := obj.Dict()
-		//传入一个struct，一定会指向struct，所以可以直接使用
-		err = unmarshalDict(p, dict)
-		if err != nil{
-			return err
+//UnmarshalTypeError表示bencode值不能赋值给对应的Go类型
+type UnmarshalTypeError struct {
+	Path	string			//出错字段的路径，如"info.files[3].length"，最外层的值为""
+	Value	string			//bencode值的描述，如"list"、"int 256"
+	Type	reflect.Type	//期望的Go类型
+	Err		error			//ErrTyp，int超出范围时为ErrRng
+}
+
+func (e *UnmarshalTypeError) Error() string{
+	if e.Path == ""{
+		return fmt.Sprintf("bencode: cannot unmarshal %s into Go value of type %v", e.Value, e.Type)
+	}
+	return fmt.Sprintf("bencode: cannot unmarshal %s into field %s of type %v", e.Value, e.Path, e.Type)
+}
+
+func (e *UnmarshalTypeError) Unwrap() error{
+	return e.Err
+}
+
+//DecoderOptions.CollectErrors为true时，Unmarshal返回收集到的所有类型错误
+type UnmarshalErrors []*UnmarshalTypeError
+
+func (e UnmarshalErrors) Error() string{
+	msgs := make([]string, len(e))
+	for i, err := range e{
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e UnmarshalErrors) Unwrap() []error{
+	errs := make([]error, len(e))
+	for i, err := range e{
+		errs[i] = err
+	}
+	return errs
+}
+
+//当前值的路径
+func (d *decodeState) pathString() string{
+	var sb strings.Builder
+	for _, seg := range d.path{
+		if sb.Len() > 0 && seg[0] != '['{
+			sb.WriteByte('.')
 		}
-	default:
-		return errors.New("src code must be struct or slice")
+		sb.WriteString(seg)
 	}
-	return nil
+	return sb.String()
 }
 
-func unmarshalList(p reflect.Value, list []*Bobject) error  {
-	//判断p是否为指针类型，且p的元素要是切片类型
-	if p.Kind() != reflect.Ptr || p.Elem().Type().Kind() != reflect.Slice{
-		return errors.New("dest must be pointer to slice")
+//赋值给v之前记录它的路径，赋值完成后调用返回的函数恢复
+func (d *decodeState) push(seg string) func(){
+	d.path = append(d.path, seg)
+	return func(){
+		d.path = d.path[:len(d.path) - 1]
 	}
-	if len(list) == 0{
+}
+
+//obj不能赋值给t类型的值；收集错误时记录下来并继续赋值其他字段
+func (d *decodeState) typeError(obj *Bobject, t reflect.Type, err error) error{
+	value := obj.btype.String()
+	switch {
+	case err == ErrRng:
+		value += " " + obj.intString()
+	case obj.btype == Bstr && t.Kind() == reflect.Array:
+		buf, _ := obj.Bytes()
+		value = fmt.Sprintf("string of length %d", len(buf))
+	}
+	e := &UnmarshalTypeError{Path: d.pathString(), Value: value, Type: t, Err: err}
+	if d.opts.CollectErrors{
+		d.errs = append(d.errs, e)
+		return nil
+	}
+	return e
+}
+
+//Unmarshaler由类型自己解码，参数是这个值完整的原始bencode编码
+type Unmarshaler interface {
+	UnmarshalBencode([]byte) error
+}
+
+var (
+	bobjectPtrType = reflect.TypeOf(&Bobject{})
+	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+)
+
+//把obj赋值给v，v必须是可修改的
+func (d *decodeState) unmarshalValue(v reflect.Value, obj *Bobject) error{
+	switch v.Type() {
+	case rawMessageType:
+		v.SetBytes(obj.rawBytes())
+		return nil
+	case bobjectType:
+		v.Set(reflect.ValueOf(*obj))
+		return nil
+	case bobjectPtrType:
+		v.Set(reflect.ValueOf(obj))
+		return nil
+	}
+
+	//可寻址的v的指针实现了Unmarshaler，交给它自己解码
+	if v.Kind() != reflect.Ptr && v.CanAddr() && v.Addr().Type().Implements(unmarshalerType){
+		return v.Addr().Interface().(Unmarshaler).UnmarshalBencode(obj.rawBytes())
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		//指针为nil时，先分配一个值
+		if v.IsNil(){
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.unmarshalValue(v.Elem(), obj)
+	case reflect.Interface:
+		//只能填入interface{}，其他接口类型无法确定具体类型
+		if v.NumMethod() != 0{
+			return d.typeError(obj, v.Type(), ErrTyp)
+		}
+		v.Set(reflect.ValueOf(obj.value()))
 		return nil
 	}
 
-	v := p.Elem()
-	//根据list的第一个元素的类型判断（？）
-	switch list[0].btype {
+	switch obj.btype {
 	case Bstr:
-		for i, obj := range list{
-			val, err := obj.Str()
-			if err != nil{
-				return err
+		val, _ := obj.Str()
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(val)
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			buf, _ := obj.Bytes()
+			v.SetBytes(buf)
+		case v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8:
+			if len(val) != v.Len(){
+				return d.typeError(obj, v.Type(), ErrTyp)
 			}
-			v.Index(i).SetString(val)
+			reflect.Copy(v, reflect.ValueOf([]byte(val)))
+		default:
+			return d.typeError(obj, v.Type(), ErrTyp)
 		}
 	case Bint:
-		for i, obj := range list{
-			val, err := obj.Int()
-			if err != nil{
-				return err
-			}
-			v.Index(i).SetInt(int64(val))
+		if v.Type() == bigIntType{
+			b, _ := obj.BigInt()
+			v.Set(reflect.ValueOf(*b))
+			return nil
 		}
-	case Blist:
-		for i, obj := range list{
-			val, err := obj.List()
-			if err != nil{
-				return err
-			}
-			//p中的元素v如果也是list，就需要再次判断是不是slice类型
-			if v.Type().Elem().Kind() != reflect.Slice{
-				return nil
+		val, err := obj.Int64()
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if err != nil || v.OverflowInt(val){
+				return d.typeError(obj, v.Type(), ErrRng)
 			}
-			//创建一个slice空指针
-			lp := reflect.New(v.Type().Elem())
-			//原因同上
-			ls := reflect.MakeSlice(v.Type().Elem(), len(val),len(val))
-			//让lp指向ls
-			lp.Elem().Set(ls)
-			err = unmarshalList(lp,val)
-			if err != nil{
-				return err
+			v.SetInt(val)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			//超出int64但在uint64范围内的值保存为big.Int
+			b, _ := obj.BigInt()
+			if !b.IsUint64() || v.OverflowUint(b.Uint64()){
+				return d.typeError(obj, v.Type(), ErrRng)
 			}
-
-			v.Index(i).Set(lp.Elem())
+			v.SetUint(b.Uint64())
+		case reflect.Bool:
+			v.SetBool(obj.intString() != "0")
+		default:
+			return d.typeError(obj, v.Type(), ErrTyp)
 		}
+	case Blist:
+		list, _ := obj.List()
+		switch v.Kind() {
+		case reflect.Slice, reflect.Array:
+			return d.unmarshalList(v, list)
+		}
+		return d.typeError(obj, v.Type(), ErrTyp)
 	case Bdict:
-		for i, obj := range list{
-			val, err := obj.Dict()
-			if err != nil{
-				return nil
-			}
-			if v.Type().Elem().Kind() != reflect.Struct{
-				return ErrTyp
-			}
-			//创建一个struct空指针
-			dp := reflect.New(v.Type().Elem())
-			err = unmarshalDict(dp, val)
-			if err != nil {
-				return err
+		dict, _ := obj.Dict()
+		switch v.Kind() {
+		case reflect.Struct:
+			return d.unmarshalDict(v, dict)
+		case reflect.Map:
+			if v.Type().Key().Kind() != reflect.String{
+				return d.typeError(obj, v.Type(), ErrTyp)
 			}
-			v.Index(i).Set(dp.Elem())
+			return d.unmarshalMap(v, dict)
 		}
+		return d.typeError(obj, v.Type(), ErrTyp)
+	default:
+		return ErrIvd
 	}
 	return nil
 }
 
-func unmarshalDict(p reflect.Value, dict map[string]*Bobject) error{
-	//判断p是否为指针类型，且p的元素要是切片类型
-	if p.Kind() != reflect.Ptr || p.Elem().Type().Kind() != reflect.Struct{
-		return errors.New("dest must be pointer to struct")
+func (d *decodeState) unmarshalList(v reflect.Value, list []*Bobject) error  {
+	switch v.Kind() {
+	case reflect.Slice:
+		//因为传入的slice可能为空或者size、cap不同，所以这里创建了一个新的slice
+		v.Set(reflect.MakeSlice(v.Type(), len(list), len(list)))
+	case reflect.Array:
+		//数组长度固定，多余的元素丢弃，不足的部分置零
+		v.Set(reflect.Zero(v.Type()))
+		if len(list) > v.Len(){
+			list = list[:v.Len()]
+		}
 	}
 
-	v := p.Elem()
-	n := v.NumField()	//得到v的字段数
-	//遍历v的所有字段
-	for i := 0; i < n; i++{
-		fv := v.Field(i)
-		//如果这个字段不能被修改就遍历下个字段
-		if !fv.CanSet(){
-			continue
+	//list中的元素类型可以各不相同，逐个赋值
+	for i, obj := range list{
+		pop := d.push("[" + strconv.Itoa(i) + "]")
+		err := d.unmarshalValue(v.Index(i), obj)
+		pop()
+		if err != nil{
+			return err
 		}
-		//得到map的key
-		ft := v.Type().Field(i)
-		key := ft.Tag.Get("bencode")
-		if key == ""{
-			key = strings.ToLower(ft.Name)
+	}
+	return nil
+}
+
+func (d *decodeState) unmarshalMap(v reflect.Value, dict map[string]*Bobject) error{
+	if v.IsNil(){
+		v.Set(reflect.MakeMap(v.Type()))
+	}
+	for key, obj := range dict{
+		ev := reflect.New(v.Type().Elem()).Elem()
+		pop := d.push(key)
+		err := d.unmarshalValue(ev, obj)
+		pop()
+		if err != nil{
+			return err
 		}
+		v.SetMapIndex(reflect.ValueOf(key).Convert(v.Type().Key()), ev)
+	}
+	return nil
+}
 
+func (d *decodeState) unmarshalDict(v reflect.Value, dict map[string]*Bobject) error{
+	sf := typeFields(v.Type())
+	var unknown map[string]*Bobject
+	//按key的顺序遍历dict，保证多个字段出错时返回的错误是确定的
+	for _, key := range sortedKeys(dict){
 		obj := dict[key]
-		if obj == nil{
+		idx, ok := sf.byKey[key]
+		if !ok{
+			if unknown == nil{
+				unknown = make(map[string]*Bobject)
+			}
+			unknown[key] = obj
 			continue
 		}
-
-		switch obj.btype {
-		case Bstr:
-			if ft.Type.Kind() != reflect.String{
-				break
-			}
-			val, _ := obj.Str()
-			fv.SetString(val)
-		case Bint:
-			if ft.Type.Kind() != reflect.Int{
-				break
-			}
-			val, _ := obj.Int()
-			fv.SetInt(int64(val))
-		case Blist:
-			if ft.Type.Kind() != reflect.Slice{
-				break
-			}
-			list, _ := obj.List()
-			lp := reflect.New(ft.Type)
-			ls := reflect.MakeSlice(ft.Type, len(list), len(list))
-			lp.Elem().Set(ls)
-			err := unmarshalList(lp, list)
-			if err != nil{
-				break
-			}
-			fv.Set(lp.Elem())
-		case Bdict:
-			if ft.Type.Kind() != reflect.Struct{
-				break
-			}
-			dict, _ := obj.Dict()
-			dp := reflect.New(ft.Type)
-			err := unmarshalDict(dp, dict)
-			if err != nil{
-				break
-			}
-			fv.Set(dp.Elem())
+		fv := v.Field(sf.fields[idx].index)
+		pop := d.push(key)
+		err := d.unmarshalValue(fv, obj)
+		pop()
+		if err != nil{
+			return err
 		}
 	}
+
+	//处理没有对应字段的key：收集到unknown字段中，或者按选项报错
+	if len(unknown) == 0{
+		return nil
+	}
+	if sf.unknown >= 0{
+		return d.unmarshalMap(v.Field(sf.unknown), unknown)
+	}
+	if d.opts.DisallowUnknownFields{
+		key := sortedKeys(unknown)[0]
+		return fmt.Errorf("%w %q in %v", ErrUnk, key, v.Type())
+	}
 	return nil
 }
+
+//把Bobject转为对应的Go值，用于填入interface{}
+func (o *Bobject) value() interface{}{
+	switch o.btype {
+	case Blist:
+		list, _ := o.List()
+		vals := make([]interface{}, len(list))
+		for i, e := range list{
+			vals[i] = e.value()
+		}
+		return vals
+	case Bdict:
+		dict, _ := o.Dict()
+		vals := make(map[string]interface{}, len(dict))
+		for k, e := range dict{
+			vals[k] = e.value()
+		}
+		return vals
+	case Bstr:
+		val, _ := o.Str()
+		return val
+	}
+	return o.bval
+}
+
+//得到obj的原始编码，如果解析时没有记录，则重新编码
+func (o *Bobject) rawBytes() []byte{
+	if o.raw != nil{
+		return o.raw
+	}
+	buf := new(bytes.Buffer)
+	_, err := o.Bencode(buf)
+	if err != nil{
+		return nil
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,34 @@
+package bencode
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type rawHolder struct {
+	Name	string		`bencode:"name"`
+	Info	RawMessage	`bencode:"info"`
+}
+
+func TestUnmarshalRawMessage(t *testing.T) {
+	info := "d1:bi1e1:a3:xyz5:filesld1:pi2eeee"
+	in := "d4:info" + info + "4:name6:archere"
+	h := new(rawHolder)
+	err := Unmarshal(bytes.NewBufferString(in), h)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "archer", h.Name)
+	assert.Equal(t, info, string(h.Info))
+
+	out := new(bytes.Buffer)
+	wlen, err := Marshal(out, h)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, in, out.String())
+	assert.Equal(t, len(in), wlen)
+
+	var raw RawMessage
+	err = Unmarshal(bytes.NewBufferString(info), &raw)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, info, string(raw))
+}
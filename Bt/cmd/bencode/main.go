@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go_code/Bt/bencode"
+	"io"
+	"os"
+
+)
+
+/*
+	bencode工具：查看和修改bencode文件(torrent文件、tracker的响应等)
+		bencode [-o out] FILE			把FILE转为格式化的JSON
+		bencode -r [-o out] FILE.json	把(修改后的)JSON转回bencode
+	FILE为"-"时从标准输入读取；不是UTF-8的string按bencode.ToJSON的约定用base64表示
+ */
+
+func main(){
+	reverse := flag.Bool("r", false, "convert JSON back to bencode")
+	output := flag.String("o", "", "output file (default stdout)")
+	flag.Usage = func(){
+		fmt.Fprintln(os.Stderr, "usage: bencode [-r] [-o out] FILE")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1{
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	data, err := readInput(flag.Arg(0))
+	if err != nil{
+		fmt.Fprintln(os.Stderr, "read input error: " + err.Error())
+		os.Exit(1)
+	}
+
+	var out []byte
+	if *reverse{
+		out, err = jsonToBencode(data)
+	}else{
+		out, err = bencodeToJSON(data)
+	}
+	if err != nil{
+		fmt.Fprintln(os.Stderr, "convert error: " + err.Error())
+		os.Exit(1)
+	}
+
+	if *output == ""{
+		_, err = os.Stdout.Write(out)
+	}else{
+		err = os.WriteFile(*output, out, 0644)
+	}
+	if err != nil{
+		fmt.Fprintln(os.Stderr, "write output error: " + err.Error())
+		os.Exit(1)
+	}
+}
+
+func readInput(name string) ([]byte, error){
+	if name == "-"{
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(name)
+}
+
+func bencodeToJSON(data []byte) ([]byte, error){
+	obj, err := bencode.ParseBytes(data)
+	if err != nil{
+		return nil, err
+	}
+	return bencode.ToJSON(obj, "  ")
+}
+
+func jsonToBencode(data []byte) ([]byte, error){
+	obj, err := bencode.FromJSON(data)
+	if err != nil{
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	_, err = obj.Bencode(buf)
+	return buf.Bytes(), err
+}
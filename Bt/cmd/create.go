@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go_code/Bt/torrent"
+	"os"
+	"strings"
+
+)
+
+//可以重复指定的选项
+type listFlag []string
+
+func (l *listFlag) String() string{
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(val string) error{
+	*l = append(*l, val)
+	return nil
+}
+
+/*
+	create [选项] PATH：为文件或目录PATH制作种子
+		每个-a是一层tracker，同一层的多个tracker用','分隔，第一个tracker同时作为announce
+ */
+func runCreate(args []string) int{
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	var trackers, webSeeds listFlag
+	fs.Var(&trackers, "a", "tracker tier, comma separated URLs (repeatable)")
+	fs.Var(&webSeeds, "w", "web seed URL (repeatable)")
+	output := fs.String("o", "", "output file (default PATH.torrent)")
+	comment := fs.String("c", "", "comment")
+	createdBy := fs.String("created-by", "go_code/Bt", "created by")
+	name := fs.String("name", "", "torrent name (default base name of PATH)")
+	pieceLen := fs.Int("piece-length", 0, "piece length in bytes (default automatic)")
+	private := fs.Bool("private", false, "mark the torrent private")
+	fs.Usage = func(){
+		fmt.Fprintln(os.Stderr, "usage: main create [options] PATH")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil{
+		return 2
+	}
+	if fs.NArg() != 1{
+		fs.Usage()
+		return 2
+	}
+	path := fs.Arg(0)
+
+	opts := torrent.CreateOptions{
+		Comment:   *comment,
+		CreatedBy: *createdBy,
+		Private:   *private,
+		WebSeeds:  webSeeds,
+		Name:      *name,
+		PieceLen:  *pieceLen,
+	}
+	for _, tier := range trackers{
+		opts.AnnounceList = append(opts.AnnounceList, strings.Split(tier, ","))
+	}
+	//只有一个tracker时不需要announce-list
+	if len(opts.AnnounceList) == 1 && len(opts.AnnounceList[0]) == 1{
+		opts.Announce = opts.AnnounceList[0][0]
+		opts.AnnounceList = nil
+	}
+
+	out := *output
+	if out == ""{
+		out = strings.TrimRight(path, string(os.PathSeparator)) + ".torrent"
+	}
+	//先在内存中制作种子再创建输出文件，输出文件在PATH中时不会被当作种子的内容
+	buf := new(bytes.Buffer)
+	tf, err := torrent.Create(buf, path, opts)
+	if err != nil{
+		fmt.Fprintln(os.Stderr, "create torrent error: " + err.Error())
+		return 1
+	}
+	if err := os.WriteFile(out, buf.Bytes(), 0644); err != nil{
+		fmt.Fprintln(os.Stderr, "create file error: " + err.Error())
+		return 1
+	}
+	fmt.Printf("%s: %d pieces, info hash %x\n", out, len(tf.PieceSHA), tf.InfoSHA)
+	return 0
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go_code/Bt/torrent"
+	"os"
+	"path/filepath"
+	"strings"
+
+)
+
+/*
+	edit [选项] FILE.torrent...：修改种子的tracker、web seed、comment和created by，info hash不变
+		-a和-w默认追加，加上-replace-trackers、-replace-webseeds时替换原有的内容(没有指定新的内容时删除)
+		没有-o时直接覆盖原文件，可以一次修改多个种子
+ */
+func runEdit(args []string) int{
+	fs := flag.NewFlagSet("edit", flag.ContinueOnError)
+	var trackers, webSeeds listFlag
+	fs.Var(&trackers, "a", "tracker tier, comma separated URLs (repeatable)")
+	fs.Var(&webSeeds, "w", "web seed URL (repeatable)")
+	replaceTrackers := fs.Bool("replace-trackers", false, "replace all trackers with -a instead of appending")
+	replaceWebSeeds := fs.Bool("replace-webseeds", false, "replace all web seeds with -w instead of appending")
+	comment := fs.String("c", "", "comment (empty to remove)")
+	createdBy := fs.String("created-by", "", "created by (empty to remove)")
+	output := fs.String("o", "", "output file (default overwrite FILE.torrent)")
+	fs.Usage = func(){
+		fmt.Fprintln(os.Stderr, "usage: main edit [options] FILE.torrent...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil{
+		return 2
+	}
+	if fs.NArg() == 0 || (*output != "" && fs.NArg() != 1){
+		fs.Usage()
+		return 2
+	}
+
+	opts := torrent.EditOptions{
+		WebSeeds:        webSeeds,
+		ReplaceTrackers: *replaceTrackers,
+		ReplaceWebSeeds: *replaceWebSeeds,
+	}
+	for _, tier := range trackers{
+		opts.Trackers = append(opts.Trackers, strings.Split(tier, ","))
+	}
+	//只修改指定了的选项
+	fs.Visit(func(f *flag.Flag){
+		switch f.Name {
+		case "c":
+			opts.Comment = comment
+		case "created-by":
+			opts.CreatedBy = createdBy
+		}
+	})
+
+	ret := 0
+	for _, path := range fs.Args(){
+		out := *output
+		if out == ""{
+			out = path
+		}
+		tf, err := editFile(path, out, opts)
+		if err != nil{
+			fmt.Fprintln(os.Stderr, path + ": " + err.Error())
+			ret = 1
+			continue
+		}
+		fmt.Printf("%s: info hash %x\n", out, tf.InfoSHA)
+	}
+	return ret
+}
+
+//编辑后先写到同目录下的临时文件再改名，失败时不会破坏原来的种子
+func editFile(path string, out string, opts torrent.EditOptions) (*torrent.TorrentFile, error){
+	data, err := os.ReadFile(path)
+	if err != nil{
+		return nil, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(out), ".edit-*.torrent")
+	if err != nil{
+		return nil, err
+	}
+	tf, err := torrent.EditTorrent(bytes.NewReader(data), tmp, opts)
+	if err == nil{
+		err = tmp.Close()
+	}else{
+		tmp.Close()
+	}
+	//覆盖时保留原文件的权限
+	mode := os.FileMode(0644)
+	if stat, err := os.Stat(out); err == nil{
+		mode = stat.Mode().Perm()
+	}
+	if err == nil{
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err == nil{
+		err = os.Rename(tmp.Name(), out)
+	}
+	if err != nil{
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return tf, nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go_code/Bt/torrent"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+)
+
+//info --json输出的内容
+type torrentInfo struct {
+	InfoHash		string		`json:"info_hash"`
+	InfoHashV2		string		`json:"info_hash_v2,omitempty"`
+	MetaVersion		int			`json:"meta_version"`
+	Name			string		`json:"name"`
+	TotalSize		int			`json:"total_size"`
+	PieceLength		int			`json:"piece_length"`
+	PieceCount		int			`json:"piece_count"`
+	Private			bool		`json:"private"`
+	Trackers		[][]string	`json:"trackers"`
+	Files			[]fileInfo	`json:"files"`
+	Comment			string		`json:"comment,omitempty"`
+	CreatedBy		string		`json:"created_by,omitempty"`
+	CreationDate	string		`json:"creation_date,omitempty"`	//RFC 3339
+	WebSeeds		[]string	`json:"web_seeds"`
+	HTTPSeeds		[]string	`json:"http_seeds"`
+	Magnet			string		`json:"magnet"`
+}
+
+type fileInfo struct {
+	Path	string	`json:"path"`
+	Length	int		`json:"length"`
+	Offset	int		`json:"offset"`
+	Padding	bool	`json:"padding,omitempty"`
+}
+
+/*
+	info [--json] FILE.torrent：显示ParseFile解析出的种子内容
+ */
+func runInfo(args []string) int{
+	fs := flag.NewFlagSet("info", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print as JSON")
+	fs.Usage = func(){
+		fmt.Fprintln(os.Stderr, "usage: main info [--json] FILE.torrent")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil{
+		return 2
+	}
+	if fs.NArg() != 1{
+		fs.Usage()
+		return 2
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil{
+		fmt.Fprintln(os.Stderr, "open file error: " + err.Error())
+		return 1
+	}
+	tf, err := torrent.ParseFile(bytes.NewReader(data))
+	if err != nil{
+		fmt.Fprintln(os.Stderr, "parse file error: " + err.Error())
+		return 1
+	}
+
+	info := newTorrentInfo(tf)
+	if *asJSON{
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(info)
+	}else{
+		err = printInfo(os.Stdout, info)
+	}
+	if err != nil{
+		fmt.Fprintln(os.Stderr, "write output error: " + err.Error())
+		return 1
+	}
+	return 0
+}
+
+func newTorrentInfo(tf *torrent.TorrentFile) *torrentInfo{
+	info := &torrentInfo{
+		InfoHash:    hex.EncodeToString(tf.InfoSHA[:]),
+		MetaVersion: tf.MetaVersion,
+		Name:        tf.FileName,
+		PieceLength: tf.PieceLen,
+		PieceCount:  tf.PieceCount(),
+		Private:     tf.Private,
+		Trackers:    tf.Tiers(),
+		Comment:     tf.Comment,
+		CreatedBy:   tf.CreatedBy,
+		WebSeeds:    tf.WebSeeds,
+		HTTPSeeds:   tf.HTTPSeeds,
+		Magnet:      tf.Magnet().String(),
+	}
+	if tf.HasV2(){
+		info.InfoHashV2 = hex.EncodeToString(tf.InfoSHA256[:])
+	}
+	if !tf.CreationDate.IsZero(){
+		info.CreationDate = tf.CreationDate.UTC().Format(time.RFC3339)
+	}
+	//单文件种子也按一个文件显示，文件名就是name
+	if len(tf.Files) == 0{
+		info.Files = []fileInfo{{Path: tf.FileName, Length: tf.FileLen}}
+		info.TotalSize = tf.FileLen
+	}
+	//总大小不包括填充文件
+	for _, f := range tf.Files{
+		info.Files = append(info.Files, fileInfo{strings.Join(f.Path, "/"), f.Length, f.Offset, f.Padding})
+		if !f.Padding{
+			info.TotalSize += f.Length
+		}
+	}
+	//JSON中的列表没有内容时输出[]而不是null
+	if info.Trackers == nil{
+		info.Trackers = [][]string{}
+	}
+	if info.WebSeeds == nil{
+		info.WebSeeds = []string{}
+	}
+	if info.HTTPSeeds == nil{
+		info.HTTPSeeds = []string{}
+	}
+	return info
+}
+
+//以表格的形式输出
+func printInfo(w io.Writer, info *torrentInfo) error{
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	row := func(key string, val string){
+		fmt.Fprintf(tw, "%s:\t%s\n", key, val)
+	}
+	row("Name", info.Name)
+	row("Info hash", info.InfoHash)
+	if info.InfoHashV2 != ""{
+		row("Info hash v2", info.InfoHashV2)
+	}
+	row("Meta version", fmt.Sprint(info.MetaVersion))
+	row("Total size", formatSize(info.TotalSize))
+	row("Piece length", formatSize(info.PieceLength))
+	row("Pieces", fmt.Sprint(info.PieceCount))
+	row("Private", yesNo(info.Private))
+	row("Created by", info.CreatedBy)
+	row("Creation date", info.CreationDate)
+	row("Comment", info.Comment)
+	if len(info.Trackers) == 0{
+		row("Trackers", "")
+	}
+	for i, tier := range info.Trackers{
+		key := ""
+		if i == 0{
+			key = "Trackers"
+		}
+		fmt.Fprintf(tw, "%s\ttier %d: %s\n", key + ":", i + 1, strings.Join(tier, " "))
+	}
+	row("Web seeds", strings.Join(info.WebSeeds, " "))
+	row("HTTP seeds", strings.Join(info.HTTPSeeds, " "))
+	row("Magnet", info.Magnet)
+	if err := tw.Flush(); err != nil{
+		return err
+	}
+
+	fmt.Fprintf(w, "\nFiles (%d):\n", len(info.Files))
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "  OFFSET\tLENGTH\t\t")
+	for _, f := range info.Files{
+		path := f.Path
+		if f.Padding{
+			path += " (padding)"
+		}
+		fmt.Fprintf(tw, "  %d\t%d\t\t%s\n", f.Offset, f.Length, path)
+	}
+	return tw.Flush()
+}
+
+//字节数和便于阅读的大小
+func formatSize(n int) string{
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	size := float64(n)
+	i := 0
+	for size >= 1024 && i < len(units) - 1{
+		size /= 1024
+		i++
+	}
+	if i == 0{
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%d (%.1f %s)", n, size, units[i])
+}
+
+func yesNo(b bool) string{
+	if b{
+		return "yes"
+	}
+	return "no"
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"go_code/Bt/torrent"
 	"os"
+	"strings"
 
 )
 
@@ -19,27 +20,56 @@ import (
  */
 
 
+/*
+	用法：
+		main FILE.torrent			下载FILE.torrent中的文件
+		main MAGNET					通过磁力链接获取种子后下载
+		main create [选项] PATH		为文件或目录PATH制作种子
+		main info [--json] FILE.torrent	显示种子的内容
+		main edit [选项] FILE.torrent...	修改种子的tracker等信息，info hash不变
+ */
 func main(){
-	//1.解析torrent文件
-	file, err := os.Open(os.Args[1])
-	if err != nil{
-		fmt.Println("open file error")
-		return
+	if len(os.Args) < 2{
+		usage()
+		os.Exit(2)
 	}
-	defer file.Close()
-	tf, err := torrent.ParseFile(bufio.NewReader(file))
-	if err != nil{
-		fmt.Println("parse file error")
+	switch os.Args[1] {
+	case "create":
+		os.Exit(runCreate(os.Args[2:]))
+	case "info":
+		os.Exit(runInfo(os.Args[2:]))
+	case "edit":
+		os.Exit(runEdit(os.Args[2:]))
+	case "-h", "-help", "--help":
+		usage()
 		return
 	}
+	download(os.Args[1])
+}
 
+func usage(){
+	fmt.Fprintln(os.Stderr, "usage: main FILE.torrent|MAGNET")
+	fmt.Fprintln(os.Stderr, "       main create [options] PATH")
+	fmt.Fprintln(os.Stderr, "       main info [--json] FILE.torrent")
+	fmt.Fprintln(os.Stderr, "       main edit [options] FILE.torrent...")
+}
+
+func download(path string){
 	//随机peer
 	var peerId [torrent.IDLEN]byte
 	_, _ = rand.Read(peerId[:])
 
-	//连接tracker并获取peer
+	//1.解析torrent文件，磁力链接则从peer获取
+	tf, extra, err := loadTorrent(path, peerId)
+	if err != nil{
+		fmt.Println("parse file error: " + err.Error())
+		return
+	}
+
+	//连接tracker并获取peer，磁力链接中的peer只有非私有种子才使用
 	peers := torrent.FindPeers(tf, peerId)
-	if len(peers) == 0{
+	peers = tf.AddPeers(peers, torrent.PeerFromCache, extra)
+	if len(peers) == 0 && len(tf.WebSeeds) == 0 && len(tf.HTTPSeeds) == 0{
 		fmt.Println("can not find peers")
 		return
 	}
@@ -48,13 +78,36 @@ func main(){
 	task := &torrent.TorrentTask{
 		PeerId:   peerId,
 		PeerList: peers,
+		WebSeeds: tf.WebSeeds,
+		HTTPSeeds: tf.HTTPSeeds,
 		InfoSHA:  tf.InfoSHA,
 		FileName: tf.FileName,
 		FileLen:  tf.FileLen,
+		Files:    tf.Files,
 		PieceLen: tf.PieceLen,
 		PieceSHA: tf.PieceSHA,
+		V2:       !tf.HasV1(),
 	}
 
 	//下载并生成文件
 	torrent.Download(task)
-}
\ No newline at end of file
+}
+
+//磁力链接还返回其中x.pe指定的peer
+func loadTorrent(path string, peerId [torrent.IDLEN]byte) (*torrent.TorrentFile, []torrent.PeerInfo, error){
+	if strings.HasPrefix(path, "magnet:"){
+		m, err := torrent.ParseMagnet(path)
+		if err != nil{
+			return nil, nil, err
+		}
+		tf, err := m.FetchTorrent(peerId)
+		return tf, m.Peers, err
+	}
+	file, err := os.Open(path)
+	if err != nil{
+		return nil, nil, err
+	}
+	defer file.Close()
+	tf, err := torrent.ParseFile(bufio.NewReader(file))
+	return tf, nil, err
+}
@@ -0,0 +1,275 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"go_code/Bt/bencode"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+)
+
+//自动选择piece长度时的范围和目标piece数
+const (
+	MinPieceLen = 16 * 1024
+	MaxPieceLen = 16 * 1024 * 1024
+	targetPieces = 1500
+)
+
+//制作种子的选项，零值的字段不写入种子
+type CreateOptions struct {
+	Announce		string		//tracker的URL，为空时使用AnnounceList的第一个
+	AnnounceList	[][]string	//分层的tracker列表
+	Comment			string
+	CreatedBy		string
+	CreationDate	time.Time	//为零值时使用当前时间
+	Private			bool		//私有种子(BEP 27)
+	WebSeeds		[]string	//url-list
+	Name			string		//info.name，为空时使用path的最后一级
+	PieceLen		int			//为0时按总长度自动选择，必须是16KB的倍数
+	Workers			int			//计算SHA的协程数，为0时使用CPU数
+}
+
+//按总长度选择piece长度：2的幂，使piece数接近targetPieces
+func autoPieceLen(total int64) int{
+	n := MinPieceLen
+	for n < MaxPieceLen && total / int64(n) > targetPieces{
+		n *= 2
+	}
+	return n
+}
+
+//Create写出的info：rawInfo中的pieces是omitempty的，空文件的种子会缺少这个key
+//pieces总是写出，length只有单文件种子写出，文件为空时也写出0
+type createInfo struct {
+	Length 			*int			`bencode:"length,omitempty"`
+	Files			[]rawFileEntry	`bencode:"files,omitempty"`
+	Name			string			`bencode:"name"`
+	PieceLength		int				`bencode:"piece length"`
+	Pieces			PieceHashes		`bencode:"pieces"`
+	Private			int				`bencode:"private,omitempty"`
+}
+
+/*
+	制作种子：
+		1. path是文件时生成单文件种子，是目录时按路径的字典序收集目录下所有的文件，生成多文件种子
+		2. 把所有文件首尾相接后按piece长度切分，并发计算每个piece的SHA
+		3. 解析生成的种子并检查，合法时才写入w，返回解析得到的TorrentFile
+*/
+func Create(w io.Writer, path string, opts CreateOptions) (*TorrentFile, error){
+	stat, err := os.Stat(path)
+	if err != nil{
+		return nil, err
+	}
+	info := new(createInfo)
+	info.Name = opts.Name
+	if info.Name == ""{
+		info.Name = filepath.Base(filepath.Clean(path))
+	}
+	var paths []string
+	var total int64
+	if stat.IsDir(){
+		paths, info.Files, total, err = walkFiles(path)
+		if err != nil{
+			return nil, err
+		}
+		if len(paths) == 0{
+			return nil, fmt.Errorf("no files in %s", path)
+		}
+	}else{
+		paths = []string{path}
+		total = stat.Size()
+		length := int(total)
+		info.Length = &length
+	}
+
+	info.PieceLength = opts.PieceLen
+	if info.PieceLength == 0{
+		info.PieceLength = autoPieceLen(total)
+	}
+	if info.PieceLength < 0 || info.PieceLength % MinPieceLen != 0{
+		return nil, fmt.Errorf("piece length %d is not a multiple of %d", info.PieceLength, MinPieceLen)
+	}
+	info.Pieces, err = hashPieces(paths, total, info.PieceLength, opts.Workers)
+	if err != nil{
+		return nil, err
+	}
+	if opts.Private{
+		info.Private = 1
+	}
+
+	raw := &rawFile{
+		Announce:     opts.Announce,
+		AnnounceList: cleanTiers(opts.AnnounceList),
+		Comment:      opts.Comment,
+		CreatedBy:    opts.CreatedBy,
+		URLList:      opts.WebSeeds,
+	}
+	if raw.Announce == "" && len(raw.AnnounceList) > 0{
+		raw.Announce = raw.AnnounceList[0][0]
+	}
+	date := opts.CreationDate
+	if date.IsZero(){
+		date = time.Now()
+	}
+	raw.CreationDate = date.Unix()
+
+	buf := new(bytes.Buffer)
+	if _, err := bencode.Marshal(buf, info); err != nil{
+		return nil, err
+	}
+	raw.Info = buf.Bytes()
+	out := new(bytes.Buffer)
+	if _, err := bencode.Marshal(out, raw); err != nil{
+		return nil, err
+	}
+	//先检查生成的种子，不合法时不写入w
+	tf, err := ParseFile(bytes.NewReader(out.Bytes()))
+	if err != nil{
+		return nil, err
+	}
+	if _, err := w.Write(out.Bytes()); err != nil{
+		return nil, err
+	}
+	return tf, nil
+}
+
+//收集root下的所有普通文件，返回文件的路径和对应的files
+func walkFiles(root string) ([]string, []rawFileEntry, int64, error){
+	var paths []string
+	var entries []rawFileEntry
+	var total int64
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error{
+		if err != nil{
+			return err
+		}
+		if !d.Type().IsRegular(){
+			return nil
+		}
+		stat, err := d.Info()
+		if err != nil{
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil{
+			return err
+		}
+		paths = append(paths, path)
+		entries = append(entries, rawFileEntry{
+			Length: int(stat.Size()),
+			Path:   strings.Split(filepath.ToSlash(rel), "/"),
+		})
+		total += stat.Size()
+		return nil
+	})
+	return paths, entries, total, err
+}
+
+//待计算SHA的一个piece
+type hashJob struct {
+	index	int
+	data	[]byte
+}
+
+//按顺序读取所有文件，每读满一个piece交给一个协程计算SHA
+func hashPieces(paths []string, total int64, pieceLen int, workers int) (PieceHashes, error){
+	if workers <= 0{
+		workers = runtime.NumCPU()
+	}
+	cnt := int((total + int64(pieceLen) - 1) / int64(pieceLen))
+	hashes := make(PieceHashes, cnt)
+	jobs := make(chan hashJob, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++{
+		wg.Add(1)
+		go func(){
+			defer wg.Done()
+			for job := range jobs{
+				hashes[job.index] = sha1.Sum(job.data)
+			}
+		}()
+	}
+
+	r := &filesReader{paths: paths}
+	var err error
+	for i := 0; i < cnt; i++{
+		//每个piece使用新的buffer，协程计算完之前不能被覆盖
+		data := make([]byte, pieceLen)
+		var n int
+		n, err = io.ReadFull(r, data)
+		if err == io.ErrUnexpectedEOF && i == cnt - 1{
+			err = nil
+		}
+		if err != nil{
+			break
+		}
+		jobs <- hashJob{i, data[:n]}
+	}
+	close(jobs)
+	wg.Wait()
+	if err == nil{
+		//读完所有piece后不应该还有数据，读到的总长度也应该和开始时一致
+		n, _ := r.Read(make([]byte, 1))
+		if n > 0 || r.read != total{
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	r.Close()
+	if err == io.EOF || err == io.ErrUnexpectedEOF{
+		return nil, fmt.Errorf("files changed while hashing")
+	}
+	if err != nil{
+		return nil, err
+	}
+	return hashes, nil
+}
+
+//把多个文件按顺序连成一个Reader，同一时刻只打开一个文件
+type filesReader struct {
+	paths	[]string
+	cur		*os.File
+	read	int64
+}
+
+func (r *filesReader) Read(p []byte) (int, error){
+	for{
+		if r.cur == nil{
+			if len(r.paths) == 0{
+				return 0, io.EOF
+			}
+			file, err := os.Open(r.paths[0])
+			if err != nil{
+				return 0, err
+			}
+			r.cur = file
+			r.paths = r.paths[1:]
+		}
+		n, err := r.cur.Read(p)
+		r.read += int64(n)
+		if err == io.EOF{
+			r.cur.Close()
+			r.cur = nil
+			if n == 0{
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *filesReader) Close() error{
+	if r.cur == nil{
+		return nil
+	}
+	err := r.cur.Close()
+	r.cur = nil
+	return err
+}
@@ -0,0 +1,125 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+)
+
+func TestCreateMultiFile(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "data")
+	assert.Equal(t, nil, os.MkdirAll(filepath.Join(root, "sub"), 0755))
+	//总长度40KB，第一个piece跨越a和sub/b
+	a := bytes.Repeat([]byte("a"), 10 * 1024)
+	b := bytes.Repeat([]byte("b"), 30 * 1024)
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(root, "a"), a, 0644))
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(root, "sub", "b"), b, 0644))
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(root, "empty"), nil, 0644))
+
+	date := time.Unix(1600000000, 0)
+	out := new(bytes.Buffer)
+	tf, err := Create(out, root, CreateOptions{
+		AnnounceList: [][]string{{"http://a/announce", "http://b/announce"}, {"http://c/announce"}},
+		Comment:      "test",
+		CreatedBy:    "go_code/Bt",
+		CreationDate: date,
+		Private:      true,
+		WebSeeds:     []string{"http://seed/"},
+		PieceLen:     MinPieceLen,
+		Workers:      3,
+	})
+	assert.Equal(t, nil, err)
+
+	//写出的种子重新解析后得到相同的InfoSHA
+	parsed, err := ParseFile(bytes.NewReader(out.Bytes()))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, tf.InfoSHA, parsed.InfoSHA)
+
+	assert.Equal(t, "data", parsed.FileName)
+	assert.Equal(t, "http://a/announce", parsed.Announce)
+	assert.Equal(t, 2, len(parsed.AnnounceList))
+	assert.Equal(t, "test", parsed.Comment)
+	assert.Equal(t, "go_code/Bt", parsed.CreatedBy)
+	assert.True(t, date.Equal(parsed.CreationDate))
+	assert.Equal(t, []string{"http://seed/"}, parsed.WebSeeds)
+	assert.Equal(t, 40 * 1024, parsed.FileLen)
+	assert.Equal(t, []FileInfo{
+		{Path: []string{"a"}, Length: 10 * 1024, Offset: 0},
+		{Path: []string{"empty"}, Length: 0, Offset: 10 * 1024},
+		{Path: []string{"sub", "b"}, Length: 30 * 1024, Offset: 10 * 1024},
+	}, parsed.Files)
+
+	all := append(append([]byte{}, a...), b...)
+	assert.Equal(t, 3, len(parsed.PieceSHA))
+	for i := range parsed.PieceSHA {
+		end := (i + 1) * MinPieceLen
+		if end > len(all) {
+			end = len(all)
+		}
+		assert.Equal(t, sha1.Sum(all[i * MinPieceLen : end]), parsed.PieceSHA[i])
+	}
+	assert.True(t, bytes.Contains(out.Bytes(), []byte("7:privatei1e")))
+	assert.True(t, parsed.Private)
+}
+
+func TestCreateSingleFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "file.iso")
+	data := bytes.Repeat([]byte("x"), 100)
+	assert.Equal(t, nil, os.WriteFile(name, data, 0644))
+
+	out := new(bytes.Buffer)
+	tf, err := Create(out, name, CreateOptions{Announce: "http://a/announce"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "file.iso", tf.FileName)
+	assert.Equal(t, 100, tf.FileLen)
+	assert.Equal(t, 0, len(tf.Files))
+	assert.Equal(t, MinPieceLen, tf.PieceLen)
+	assert.Equal(t, [][SHALEN]byte{sha1.Sum(data)}, tf.PieceSHA)
+	assert.False(t, bytes.Contains(out.Bytes(), []byte("announce-list")))
+
+	_, err = Create(out, name, CreateOptions{PieceLen: 1000})
+	assert.NotEqual(t, nil, err)
+}
+
+func TestAutoPieceLen(t *testing.T) {
+	assert.Equal(t, MinPieceLen, autoPieceLen(0))
+	assert.Equal(t, 256 * 1024, autoPieceLen(300 << 20))
+	assert.Equal(t, MaxPieceLen, autoPieceLen(1 << 40))
+}
+
+func TestCreateEmpty(t *testing.T) {
+	//空文件和只有空文件的目录：length和pieces都是必需的key
+	dir := t.TempDir()
+	name := filepath.Join(dir, "empty.bin")
+	assert.Equal(t, nil, os.WriteFile(name, nil, 0644))
+	out := new(bytes.Buffer)
+	tf, err := Create(out, name, CreateOptions{CreationDate: time.Unix(1, 0)})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, tf.FileLen)
+	assert.Equal(t, 0, len(tf.PieceSHA))
+	assert.True(t, bytes.Contains(out.Bytes(), []byte("4:infod6:lengthi0e4:name9:empty.bin12:piece lengthi16384e6:pieces0:e")))
+
+	sub := filepath.Join(dir, "sub")
+	assert.Equal(t, nil, os.Mkdir(sub, 0755))
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(sub, "a"), nil, 0644))
+	out.Reset()
+	tf, err = Create(out, sub, CreateOptions{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(tf.Files))
+	assert.True(t, bytes.Contains(out.Bytes(), []byte("4:infod5:filesld6:lengthi0e4:pathl1:aeee4:name3:sub12:piece lengthi16384e6:pieces0:e")))
+}
+
+func TestCreateInvalidName(t *testing.T) {
+	dir := t.TempDir()
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(dir, "a"), []byte("x"), 0644))
+	//name不合法时不写入任何内容
+	out := new(bytes.Buffer)
+	_, err := Create(out, dir, CreateOptions{Name: ".."})
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, 0, out.Len())
+}
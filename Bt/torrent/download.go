@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"crypto/sha1"
 	"fmt"
-	"os"
 	"time"
 )
 
@@ -16,17 +15,25 @@ const(
 type TorrentTask struct {
 	PeerId		[IDLEN]byte		//客户端ID
 	PeerList 	[]PeerInfo		//从tracker获取到的peer
+	WebSeeds	[]string		//url-list中的HTTP镜像
+	HTTPSeeds	[]string		//httpseeds中按BEP 17协议提供piece的服务器
 	InfoSHA 	[SHALEN]byte
-	FileName 	string
-	FileLen		int
+	FileName 	string			//单文件时是文件名，多文件时是根目录名，最后一级是种子中的name
+	FileLen		int				//所有文件的总长度
+	Files		[]FileInfo		//多文件种子中的文件，单文件种子为空
 	PieceLen 	int
 	PieceSHA 	[][SHALEN]byte
+	V2			bool			//按v2(BEP 52)的merkle树校验piece，Files中带有校验数据
 }
 
 type pieceTask struct {
 	index	int
 	sha		[SHALEN]byte
+	begin	int		//piece在所有文件首尾相接后的数据中的起始位置
 	length	int
+	//v2：piece对应的merkle树节点，以及构建子树时的叶子数，leaves为0表示按v1校验
+	root	[SHA256LEN]byte
+	leaves	int
 }
 
 //下载的中间状态
@@ -47,63 +54,127 @@ type pieceResult struct {
 /*
 	流程：
 		1.把所有待下载的task放到一个channel中
-		2.给每个peer起一个go协程
+		2.给每个peer、web seed和http seed起一个go协程
 		3.每个协程从channel中获取一个task
 		4.下载完成后将result放入一个channel中，再送去校验(SHA)
-		5.校验完成后无误，写入最终的data中
+		5.校验完成后无误，写入piece对应的文件中
+	所有协程都退出(连接失败或连续失败后放弃)而piece还没有下载完时返回错误
  */
 func Download(task *TorrentTask) error{
 	fmt.Println("start downloading " + task.FileName)
 
+	//先创建所有文件，piece下载完成后直接写入
+	store, err := openStorage(task)
+	if err != nil{
+		fmt.Println("fail to create file: " + task.FileName)
+		return err
+	}
+	defer store.Close()
+
+	pieces := task.pieceTasks()
 	//初始化taskchannel
-	taskQueue := make(chan *pieceTask, len(task.PieceSHA))
+	taskQueue := make(chan *pieceTask, len(pieces))
 	//初始化resultchannel
 	resultQueue := make(chan *pieceResult)
 
 	//将所有任务遍历，放入channel中
-	for index, sha := range task.PieceSHA{
-		begin, end := task.getPieceBounds(index)
-		taskQueue <- &pieceTask{
-			index:  index,
-			sha:    sha,
-			length: (end - begin),
-		}
+	for _, piece := range pieces{
+		taskQueue <- piece
 	}
 
+	//每个协程退出时发送一次，所有协程都退出后不会再有result
+	workers := len(task.PeerList) + len(task.WebSeeds) + len(task.HTTPSeeds)
+	exited := make(chan struct{}, workers)
+	run := func(routine func()){
+		go func(){
+			defer func(){ exited <- struct{}{} }()
+			routine()
+		}()
+	}
 	//给每个peer起一个go协程
 	for _, peer := range task.PeerList{
-		go task.peerRoutine(peer, taskQueue, resultQueue)
+		peer := peer
+		run(func(){ task.peerRoutine(peer, taskQueue, resultQueue) })
+	}
+	//每个web seed也起一个协程，从同一个channel中获取task
+	for _, seed := range task.WebSeeds{
+		seed := seed
+		run(func(){ task.webSeedRoutine(seed, taskQueue, resultQueue) })
+	}
+	for _, seed := range task.HTTPSeeds{
+		seed := seed
+		run(func(){ task.httpSeedRoutine(seed, taskQueue, resultQueue) })
 	}
 
-	//把result channel里的所有piece的信息写到缓存buf中
-	buf := make([]byte, task.FileLen)
+	//把result channel里的所有piece写到对应的文件中
 	count := 0
-	for count <len(task.PieceSHA){
-		res :=  <-resultQueue
-		begin, end := task.getPieceBounds(res.index)
-		copy(buf[begin : end], res.data)
+	for count <len(pieces){
+		if workers == 0{
+			return fmt.Errorf("all peers and seeds failed, downloaded %d of %d pieces", count, len(pieces))
+		}
+		var res *pieceResult
+		select {
+		case res = <-resultQueue:
+		case <-exited:
+			workers--
+			continue
+		}
+		err := store.WriteAt(res.data, pieces[res.index].begin)
+		if err != nil{
+			fmt.Println("fail to write data")
+			return err
+		}
 		count++
 		//打印piece下载进度
-		percent := float64(count) / float64(len(task.PieceSHA)) * 100
+		percent := float64(count) / float64(len(pieces)) * 100
 		fmt.Printf("downloading, progress : (%0.2f%%)\n", percent)
 	}
 
 	close(taskQueue)
 	close(resultQueue)
 
-	//创建一个文件，把buf中的data写入文件中
-	file, err := os.Create(task.FileName)
-	if err != nil{
-		fmt.Println("fail to create file: " + task.FileName)
-		return err
+	return store.Close()
+}
+
+//生成所有piece的下载任务，下标和piece的index一致
+func (task *TorrentTask) pieceTasks() []*pieceTask{
+	if !task.V2{
+		pieces := make([]*pieceTask, len(task.PieceSHA))
+		for index, sha := range task.PieceSHA{
+			begin, end := task.getPieceBounds(index)
+			pieces[index] = &pieceTask{index: index, sha: sha, begin: begin, length: end - begin}
+		}
+		return pieces
 	}
-	_, err = file.Write(buf)
-	if err != nil{
-		fmt.Println("fail to write data")
-		return err
+	//v2的每个文件单独切分piece，文件的起始位置已经对齐到piece长度
+	var pieces []*pieceTask
+	for _, f := range task.Files{
+		if f.Padding{
+			continue
+		}
+		for begin := 0; begin < f.Length; begin += task.PieceLen{
+			length := task.PieceLen
+			if f.Length - begin < length{
+				length = f.Length - begin
+			}
+			piece := &pieceTask{
+				index:  (f.Offset + begin) / task.PieceLen,
+				begin:  f.Offset + begin,
+				length: length,
+			}
+			if len(f.PieceLayer) > 0{
+				//和piece layer中的节点比较，最后一个piece不足的部分补0
+				piece.root = f.PieceLayer[begin / task.PieceLen]
+				piece.leaves = task.PieceLen / BLOCKSIZE
+			}else{
+				//不超过一个piece的文件，直接和pieces root比较
+				piece.root = f.PiecesRoot
+				piece.leaves = nextPow2((length + BLOCKSIZE - 1) / BLOCKSIZE)
+			}
+			pieces = append(pieces, piece)
+		}
 	}
-
-	return nil
+	return pieces
 }
 
 //得到一段piece的起始和结束
@@ -219,10 +290,16 @@ func (state *taskState)handleMsg() error{
 	return nil
 }
 
-//校验piece的sha是否一致
+//校验piece的sha是否一致，v2校验merkle树
 func checkPiece(task *pieceTask, res *pieceResult) bool{
-	sha := sha1.Sum(res.data)
-	if !bytes.Equal(task.sha[:], sha[:]){
+	var ok bool
+	if task.leaves > 0{
+		ok = merkleRoot(blockHashes(res.data), task.leaves, [SHA256LEN]byte{}) == task.root
+	}else{
+		sha := sha1.Sum(res.data)
+		ok = bytes.Equal(task.sha[:], sha[:])
+	}
+	if !ok{
 		fmt.Printf("check integrity failed, index :%v\n", res.index)
 		return false
 	}
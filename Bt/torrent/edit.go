@@ -0,0 +1,158 @@
+package torrent
+
+import (
+	"bytes"
+	"fmt"
+	"go_code/Bt/bencode"
+	"io"
+
+)
+
+/*
+	修改已有种子中info之外的内容：tracker、web seed、comment和created by
+	info保持原始编码不变，InfoSHA也就不变，正在运行的swarm不受影响
+	其他不认识的key也原样保留
+*/
+type EditOptions struct {
+	Trackers		[][]string	//分层的tracker，ReplaceTrackers为false时追加到原有的tracker后面
+	ReplaceTrackers	bool		//用Trackers替换所有原有的tracker，Trackers为空时删除所有tracker
+	WebSeeds		[]string	//url-list中的web seed，ReplaceWebSeeds为false时追加到原有的web seed后面
+	ReplaceWebSeeds	bool
+	Comment			*string		//nil时不修改，空字符串时删除
+	CreatedBy		*string		//nil时不修改，空字符串时删除
+}
+
+//从r读取种子，按opts修改后写入w，返回修改后的种子
+func EditTorrent(r io.Reader, w io.Writer, opts EditOptions) (*TorrentFile, error){
+	data, err := io.ReadAll(r)
+	if err != nil{
+		return nil, err
+	}
+	tf, err := ParseFile(bytes.NewReader(data))
+	if err != nil{
+		return nil, err
+	}
+	var dict map[string]bencode.RawMessage
+	err = bencode.UnmarshalBytes(data, &dict)
+	if err != nil{
+		return nil, err
+	}
+
+	//tracker：announce是第一层的第一个，只有一个tracker时不需要announce-list
+	if opts.ReplaceTrackers || len(opts.Trackers) > 0{
+		tiers := opts.Trackers
+		if !opts.ReplaceTrackers{
+			tiers = appendTiers(tf.Tiers(), opts.Trackers)
+		}
+		tiers = cleanTiers(tiers)
+		delete(dict, "announce")
+		delete(dict, "announce-list")
+		if len(tiers) > 0{
+			err = setKey(dict, "announce", tiers[0][0])
+			if err == nil && (len(tiers) > 1 || len(tiers[0]) > 1){
+				err = setKey(dict, "announce-list", tiers)
+			}
+			if err != nil{
+				return nil, err
+			}
+		}
+	}
+
+	if opts.ReplaceWebSeeds || len(opts.WebSeeds) > 0{
+		seeds := opts.WebSeeds
+		if !opts.ReplaceWebSeeds{
+			seeds = appendUnique(append([]string(nil), tf.WebSeeds...), opts.WebSeeds)
+		}
+		delete(dict, "url-list")
+		if len(seeds) > 0{
+			if err := setKey(dict, "url-list", seeds); err != nil{
+				return nil, err
+			}
+		}
+	}
+
+	if opts.Comment != nil{
+		delete(dict, "comment")
+		if *opts.Comment != ""{
+			if err := setKey(dict, "comment", *opts.Comment); err != nil{
+				return nil, err
+			}
+		}
+	}
+	if opts.CreatedBy != nil{
+		delete(dict, "created by")
+		if *opts.CreatedBy != ""{
+			if err := setKey(dict, "created by", *opts.CreatedBy); err != nil{
+				return nil, err
+			}
+		}
+	}
+
+	out := new(bytes.Buffer)
+	if _, err := bencode.Marshal(out, dict); err != nil{
+		return nil, err
+	}
+	edited, err := ParseFile(bytes.NewReader(out.Bytes()))
+	if err != nil{
+		return nil, err
+	}
+	if edited.InfoSHA != tf.InfoSHA{
+		return nil, fmt.Errorf("info hash changed after editing")
+	}
+	if _, err := w.Write(out.Bytes()); err != nil{
+		return nil, err
+	}
+	return edited, nil
+}
+
+//把v编码后作为dict中key的值
+func setKey(dict map[string]bencode.RawMessage, key string, v interface{}) error{
+	buf := new(bytes.Buffer)
+	if _, err := bencode.Marshal(buf, v); err != nil{
+		return err
+	}
+	dict[key] = buf.Bytes()
+	return nil
+}
+
+//把add中的tracker追加到tiers后面，已有的tracker跳过
+func appendTiers(tiers [][]string, add [][]string) [][]string{
+	var seen []string
+	ret := make([][]string, 0, len(tiers) + len(add))
+	for _, tier := range tiers{
+		ret = append(ret, append([]string(nil), tier...))
+		seen = append(seen, tier...)
+	}
+	for _, tier := range add{
+		var urls []string
+		for _, u := range tier{
+			if !contains(seen, u){
+				urls = append(urls, u)
+				seen = append(seen, u)
+			}
+		}
+		if len(urls) > 0{
+			ret = append(ret, urls)
+		}
+	}
+	return ret
+}
+
+//把add中没有出现过的字符串追加到list后面
+func appendUnique(list []string, add []string) []string{
+	for _, s := range add{
+		if !contains(list, s){
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+func contains(list []string, s string) bool{
+	for _, v := range list{
+		if v == s{
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"github.com/stretchr/testify/assert"
+	"go_code/Bt/bencode"
+	"os"
+	"testing"
+
+)
+
+func TestEditTorrent(t *testing.T) {
+	data, err := os.ReadFile("../testfile/debian-iso.torrent")
+	assert.Equal(t, nil, err)
+	orig, err := ParseFile(bytes.NewReader(data))
+	assert.Equal(t, nil, err)
+
+	comment := "edited"
+	out := new(bytes.Buffer)
+	tf, err := EditTorrent(bytes.NewReader(data), out, EditOptions{
+		Trackers:        [][]string{{"http://a/announce", "http://b/announce"}, {"udp://c:80"}},
+		ReplaceTrackers: true,
+		WebSeeds:        []string{"http://mirror/"},
+		Comment:         &comment,
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, orig.InfoSHA, tf.InfoSHA)
+	assert.Equal(t, "http://a/announce", tf.Announce)
+	assert.Equal(t, [][]string{{"http://a/announce", "http://b/announce"}, {"udp://c:80"}}, tf.AnnounceList)
+	assert.Equal(t, []string{"http://mirror/"}, tf.WebSeeds)
+	assert.Equal(t, "edited", tf.Comment)
+	//没有修改的内容保持不变
+	assert.Equal(t, orig.HTTPSeeds, tf.HTTPSeeds)
+	assert.Equal(t, orig.CreationDate, tf.CreationDate)
+
+	//info的原始编码不变
+	var before, after map[string]bencode.RawMessage
+	assert.Equal(t, nil, bencode.UnmarshalBytes(data, &before))
+	assert.Equal(t, nil, bencode.UnmarshalBytes(out.Bytes(), &after))
+	assert.Equal(t, before["info"], after["info"])
+	assert.Equal(t, sha1.Sum(after["info"]), tf.InfoSHA)
+
+	//追加时跳过已有的tracker，comment为空时删除
+	empty := ""
+	data = out.Bytes()
+	out = new(bytes.Buffer)
+	tf, err = EditTorrent(bytes.NewReader(data), out, EditOptions{
+		Trackers: [][]string{{"udp://c:80", "http://d/announce"}},
+		Comment:  &empty,
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, [][]string{{"http://a/announce", "http://b/announce"}, {"udp://c:80"}, {"http://d/announce"}}, tf.AnnounceList)
+	assert.Equal(t, []string{"http://mirror/"}, tf.WebSeeds)
+	assert.Equal(t, "", tf.Comment)
+	assert.False(t, bytes.Contains(out.Bytes(), []byte("7:comment")))
+
+	//替换为空时删除所有tracker
+	tf, err = EditTorrent(bytes.NewReader(out.Bytes()), new(bytes.Buffer), EditOptions{ReplaceTrackers: true, ReplaceWebSeeds: true})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "", tf.Announce)
+	assert.Equal(t, 0, len(tf.AnnounceList))
+	assert.Equal(t, 0, len(tf.WebSeeds))
+	assert.Equal(t, orig.InfoSHA, tf.InfoSHA)
+}
+
+func TestEditTorrentKeepsUnknownKeys(t *testing.T) {
+	//info中的key没有按字典序排列，顶层有不认识的key
+	info := "d4:name3:abc6:lengthi5e12:piece lengthi16384e6:pieces20:aaaaaaaaaaaaaaaaaaaae"
+	in := "d8:announce9:http://a/4:info" + info + "5:nodesll1:hi1eeee"
+	_, err := EditTorrent(bytes.NewBufferString("d4:infoi1ee"), new(bytes.Buffer), EditOptions{})
+	assert.NotEqual(t, nil, err)
+
+	out := new(bytes.Buffer)
+	tf, err := EditTorrent(bytes.NewBufferString(in), out, EditOptions{Trackers: [][]string{{"http://b/"}}})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, sha1.Sum([]byte(info)), tf.InfoSHA)
+	assert.Equal(t, "d8:announce9:http://a/13:announce-listll9:http://a/el9:http://b/ee4:info" + info + "5:nodesll1:hi1eeee", out.String())
+}
@@ -8,7 +8,7 @@ import (
 /*
 握手消息：1byte(表示第二块的长度：0x13) 	part1
 		19byte(协议)  				part2
-		8byte(保留位，全是空的，为协议拓展预留) 	part3
+		8byte(保留位，为协议拓展预留，如扩展协议BEP 10) 	part3
 		20byte(InfoSHA) 			part4
 		20byte(peerId)				part5
  */
@@ -21,10 +21,27 @@ const(
 
 type HandshakeMsg struct {
 	PreStr string	//协议
+	Flags [Reserved]byte	//保留位，用来表示支持的扩展协议
 	InfoSHA [SHALEN]byte
 	PeerId [IDLEN]byte
 }
 
+//保留位中表示支持扩展协议(BEP 10)的位
+const (
+	extFlagByte = 5
+	extFlagBit byte = 0x10
+)
+
+//设置支持扩展协议的标志
+func (msg *HandshakeMsg) SetExtended(){
+	msg.Flags[extFlagByte] |= extFlagBit
+}
+
+//对方是否支持扩展协议
+func (msg *HandshakeMsg) SupportsExtended() bool{
+	return msg.Flags[extFlagByte] & extFlagBit != 0
+}
+
 func NewHandshakeMsg(infoSHA [SHALEN]byte, peerId [IDLEN]byte) *HandshakeMsg{
 	return &HandshakeMsg{
 		PreStr:  "BitTorrent protocol",
@@ -39,7 +56,7 @@ func WriteHandShake(w io.Writer, msg *HandshakeMsg) (int, error){
 	buf[0] = byte(len(msg.PreStr))	//给第一位赋值，为协议的长度
 	curr := 1
 	curr += copy(buf[curr:], []byte(msg.PreStr))	//把协议part写入缓冲区
-	curr += copy(buf[curr:], make([]byte, Reserved))	//加上8byte的保留位，值为空
+	curr += copy(buf[curr:], msg.Flags[:])	//加上8byte的保留位
 	curr += copy(buf[curr:], msg.InfoSHA[:])	//把infoSHA写入缓冲区
 	curr += copy(buf[curr:], msg.PeerId[:])		//把PeerId写入缓冲区
 	return w.Write(buf)
@@ -92,9 +109,11 @@ func ReadHandShake(r io.Reader)(*HandshakeMsg, error){
 	var peerId [IDLEN]byte
 	copy(peerId[:], peerIdBuf)
 
-	return &HandshakeMsg{
-		PreStr:  string(resBuf),
+	msg := &HandshakeMsg{
+		PreStr:  string(preBuf),
 		InfoSHA: infoSHA,
 		PeerId:  peerId,
-	}, nil
+	}
+	copy(msg.Flags[:], resBuf)
+	return msg, nil
 }
\ No newline at end of file
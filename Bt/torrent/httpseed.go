@@ -0,0 +1,141 @@
+package torrent
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+)
+
+/*
+	http seed(BEP 17)：服务器按piece提供数据
+		请求：GET <url>?info_hash=<info hash>&piece=<index>[&ranges=<start>-<end>,...]
+			ranges是piece内的字节范围(包含end)，没有ranges时返回整个piece
+		响应：200时body是请求的数据；503时body是一个整数，表示需要等待的秒数后再请求
+	数据不完整时用ranges请求剩下的部分
+*/
+
+//等待的时间上限，防止服务器让协程一直等下去：单次等待不超过它，没有下载成功时累计等待超过它就放弃
+const httpSeedMaxWait = 10 * time.Minute
+
+//没有下载成功时连续收到503的次数上限
+const httpSeedMaxBusy = 10
+
+//服务器要求等待一段时间后再请求
+type httpSeedBusy struct {
+	wait	time.Duration
+}
+
+func (e *httpSeedBusy) Error() string{
+	return fmt.Sprintf("http seed busy, retry after %v", e.wait)
+}
+
+func (task *TorrentTask) httpSeedRoutine(seed string, taskQueue chan *pieceTask, resultQueue chan *pieceResult){
+	cli := &http.Client{Timeout: 30 * time.Second}
+	fails := 0
+	busies := 0
+	var waited time.Duration
+	for piece := range taskQueue{
+		res, err := task.downloadHTTPSeedPiece(cli, seed, piece)
+		if busy, ok := err.(*httpSeedBusy); ok{
+			//服务器繁忙不算失败，把task放回去，等待后再继续；一直繁忙时放弃这个http seed
+			taskQueue <- piece
+			fmt.Println("http seed " + seed + ": " + busy.Error())
+			busies++
+			waited += busy.wait
+			if busies >= httpSeedMaxBusy || waited > httpSeedMaxWait{
+				return
+			}
+			time.Sleep(busy.wait)
+			continue
+		}
+		if err == nil && !checkPiece(piece, res){
+			err = fmt.Errorf("piece %d check failed", piece.index)
+		}
+		if err != nil{
+			taskQueue <- piece
+			fmt.Println("fail to download piece from http seed " + seed + ": " + err.Error())
+			fails++
+			if fails >= webSeedMaxFails{
+				return
+			}
+			continue
+		}
+		fails = 0
+		busies = 0
+		waited = 0
+		resultQueue <- res
+	}
+}
+
+func (task *TorrentTask) downloadHTTPSeedPiece(cli *http.Client, seed string, piece *pieceTask) (*pieceResult, error){
+	data := make([]byte, piece.length)
+	got := 0
+	for got < piece.length{
+		n, err := task.fetchHTTPSeed(cli, seed, piece.index, got, data[got:])
+		if err != nil{
+			return nil, err
+		}
+		if n == 0{
+			return nil, fmt.Errorf("http seed returned no data for piece %d", piece.index)
+		}
+		got += n
+	}
+	return &pieceResult{index: piece.index, data: data}, nil
+}
+
+//请求piece中从offset开始的数据，返回读到的长度
+func (task *TorrentTask) fetchHTTPSeed(cli *http.Client, seed string, index int, offset int, buf []byte) (int, error){
+	u, err := url.Parse(seed)
+	if err != nil{
+		return 0, err
+	}
+	params := u.Query()
+	params.Set("info_hash", string(task.InfoSHA[:]))
+	params.Set("piece", strconv.Itoa(index))
+	if offset > 0{
+		params.Set("ranges", fmt.Sprintf("%d-%d", offset, offset + len(buf) - 1))
+	}
+	u.RawQuery = params.Encode()
+
+	resp, err := cli.Get(u.String())
+	if err != nil{
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusServiceUnavailable:
+		return 0, &httpSeedBusy{retryAfter(resp)}
+	default:
+		return 0, fmt.Errorf("http seed %s: %s", seed, resp.Status)
+	}
+	n, err := io.ReadFull(resp.Body, buf)
+	if err == io.ErrUnexpectedEOF || err == io.EOF{
+		err = nil
+	}
+	return n, err
+}
+
+//503响应的body是等待的秒数，也兼容Retry-After头，都没有时等待1分钟
+func retryAfter(resp *http.Response) time.Duration{
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 32))
+	val := strings.TrimSpace(string(body))
+	if val == ""{
+		val = resp.Header.Get("Retry-After")
+	}
+	secs, err := strconv.Atoi(val)
+	if err != nil || secs < 0{
+		return time.Minute
+	}
+	wait := time.Duration(secs) * time.Second
+	if wait > httpSeedMaxWait{
+		wait = httpSeedMaxWait
+	}
+	return wait
+}
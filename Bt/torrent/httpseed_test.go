@@ -0,0 +1,124 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+)
+
+//按BEP 17提供data的服务器：每个piece的第一次请求返回503，第二次只返回一半的数据
+func newHTTPSeed(t *testing.T, infoSHA [SHALEN]byte, data []byte, pieceLen int) *httptest.Server {
+	var mu sync.Mutex
+	hits := make(map[int]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("info_hash") != string(infoSHA[:]) {
+			http.NotFound(w, r)
+			return
+		}
+		index, _ := strconv.Atoi(q.Get("piece"))
+		begin := index * pieceLen
+		end := begin + pieceLen
+		if end > len(data) {
+			end = len(data)
+		}
+		piece := data[begin:end]
+
+		mu.Lock()
+		hits[index]++
+		hit := hits[index]
+		mu.Unlock()
+		switch {
+		case hit == 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, "0")
+		case q.Get("ranges") != "":
+			var from, to int
+			fmt.Sscanf(q.Get("ranges"), "%d-%d", &from, &to)
+			w.Write(piece[from : to + 1])
+		default:
+			w.Write(piece[:len(piece) / 2])
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHTTPSeedDownload(t *testing.T) {
+	data := bytes.Repeat([]byte("httpseed"), 5000)
+	pieceLen := MinPieceLen
+	var hashes [][SHALEN]byte
+	for begin := 0; begin < len(data); begin += pieceLen {
+		end := begin + pieceLen
+		if end > len(data) {
+			end = len(data)
+		}
+		hashes = append(hashes, sha1.Sum(data[begin:end]))
+	}
+	var infoSHA [SHALEN]byte
+	infoSHA[0] = 1
+	srv := newHTTPSeed(t, infoSHA, data, pieceLen)
+
+	task := &TorrentTask{
+		HTTPSeeds: []string{srv.URL + "/seed?x=1"},
+		InfoSHA:   infoSHA,
+		FileName:  filepath.Join(t.TempDir(), "file"),
+		FileLen:   len(data),
+		PieceLen:  pieceLen,
+		PieceSHA:  hashes,
+	}
+	assert.Equal(t, nil, Download(task))
+	got, err := os.ReadFile(task.FileName)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, data, got)
+}
+
+func TestHTTPSeedRetryAfter(t *testing.T) {
+	resp := func(body string, header string) *http.Response {
+		r := &http.Response{Header: http.Header{}, Body: http.NoBody}
+		if body != "" {
+			r.Body = io.NopCloser(strings.NewReader(body))
+		}
+		if header != "" {
+			r.Header.Set("Retry-After", header)
+		}
+		return r
+	}
+	assert.Equal(t, 30 * time.Second, retryAfter(resp("30\n", "")))
+	assert.Equal(t, 5 * time.Second, retryAfter(resp("", "5")))
+	assert.Equal(t, time.Minute, retryAfter(resp("soon", "")))
+	assert.Equal(t, httpSeedMaxWait, retryAfter(resp("99999", "")))
+}
+
+func TestHTTPSeedAllFail(t *testing.T) {
+	//http seed连续失败或一直繁忙时放弃，所有http seed都放弃后Download返回错误
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	busy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, "0")
+	}))
+	defer busy.Close()
+
+	data := bytes.Repeat([]byte("httpseed"), 5000)
+	task := &TorrentTask{
+		HTTPSeeds: []string{notFound.URL, busy.URL},
+		FileName:  filepath.Join(t.TempDir(), "file"),
+		FileLen:   len(data),
+		PieceLen:  MinPieceLen,
+		PieceSHA:  make([][SHALEN]byte, (len(data) + MinPieceLen - 1) / MinPieceLen),
+	}
+	assert.NotEqual(t, nil, Download(task))
+}
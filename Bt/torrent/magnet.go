@@ -0,0 +1,200 @@
+package torrent
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+)
+
+/*
+	磁力链接：magnet:?xt=urn:btih:<info hash>&dn=<名字>&tr=<tracker>&ws=<web seed>&x.pe=<ip:port>
+		info hash是40位的十六进制或32位的base32
+		v2的种子(BEP 52)使用xt=urn:btmh:1220<64位十六进制的SHA-256>，hybrid种子同时有btih和btmh
+		tr、ws、x.pe可以出现多次
+*/
+type Magnet struct {
+	InfoSHA		[SHALEN]byte		//btih，只有btmh时是InfoSHA256的前20byte，用于握手和tracker
+	InfoSHA256	[SHA256LEN]byte		//btmh，没有时为零值
+	V2Only		bool				//只有btmh，没有btih
+	Name		string		//dn
+	Trackers	[]string	//tr
+	WebSeeds	[]string	//ws
+	Peers		[]PeerInfo	//x.pe
+}
+
+const (
+	magnetPrefix = "magnet:?"
+	btihPrefix = "urn:btih:"
+	btmhPrefix = "urn:btmh:"
+	sha256Multihash = "1220"	//multihash的前缀：0x12表示SHA-256，0x20是长度
+)
+
+func ParseMagnet(uri string) (*Magnet, error){
+	if !strings.HasPrefix(uri, magnetPrefix){
+		return nil, fmt.Errorf("not a magnet link: %q", uri)
+	}
+	params, err := url.ParseQuery(uri[len(magnetPrefix):])
+	if err != nil{
+		return nil, err
+	}
+
+	m := new(Magnet)
+	btih, btmh := false, false
+	for _, xt := range params["xt"]{
+		switch {
+		case strings.HasPrefix(xt, btihPrefix) && !btih:
+			m.InfoSHA, err = parseBtih(xt[len(btihPrefix):])
+			btih = true
+		case strings.HasPrefix(xt, btmhPrefix) && !btmh:
+			m.InfoSHA256, err = parseBtmh(xt[len(btmhPrefix):])
+			btmh = true
+		}
+		if err != nil{
+			return nil, err
+		}
+	}
+	if !btih && !btmh{
+		return nil, fmt.Errorf("magnet link has no btih or btmh")
+	}
+	if !btih{
+		m.V2Only = true
+		copy(m.InfoSHA[:], m.InfoSHA256[:SHALEN])
+	}
+	m.Name = params.Get("dn")
+	m.Trackers = params["tr"]
+	m.WebSeeds = params["ws"]
+	//格式不对的peer直接跳过
+	for _, pe := range params["x.pe"]{
+		host, port, err := net.SplitHostPort(pe)
+		if err != nil{
+			continue
+		}
+		ip := net.ParseIP(host)
+		p, err := strconv.ParseUint(port, 10, 16)
+		if ip == nil || err != nil{
+			continue
+		}
+		m.Peers = append(m.Peers, PeerInfo{Ip: ip, Port: uint16(p)})
+	}
+	return m, nil
+}
+
+//info hash可以是十六进制或base32编码
+func parseBtih(str string) ([SHALEN]byte, error){
+	var sha [SHALEN]byte
+	var buf []byte
+	var err error
+	switch len(str) {
+	case hex.EncodedLen(SHALEN):
+		buf, err = hex.DecodeString(str)
+	case base32.StdEncoding.EncodedLen(SHALEN):
+		buf, err = base32.StdEncoding.DecodeString(strings.ToUpper(str))
+	default:
+		err = fmt.Errorf("wrong length %d", len(str))
+	}
+	if err != nil{
+		return sha, fmt.Errorf("malformed btih %q: %w", str, err)
+	}
+	copy(sha[:], buf)
+	return sha, nil
+}
+
+//btmh只支持SHA-256的multihash
+func parseBtmh(str string) ([SHA256LEN]byte, error){
+	var sha [SHA256LEN]byte
+	if len(str) != len(sha256Multihash) + hex.EncodedLen(SHA256LEN) || !strings.HasPrefix(str, sha256Multihash){
+		return sha, fmt.Errorf("malformed btmh %q", str)
+	}
+	buf, err := hex.DecodeString(str[len(sha256Multihash):])
+	if err != nil{
+		return sha, fmt.Errorf("malformed btmh %q: %w", str, err)
+	}
+	copy(sha[:], buf)
+	return sha, nil
+}
+
+//是否有v2的info hash
+func (m *Magnet) HasV2() bool{
+	return m.InfoSHA256 != [SHA256LEN]byte{}
+}
+
+//检查获取到的info和磁力链接中的info hash是否一致
+func (m *Magnet) checkInfo(info []byte) error{
+	if !m.V2Only{
+		if sha := sha1.Sum(info); sha != m.InfoSHA{
+			return fmt.Errorf("metadata hash mismatch: %x", sha)
+		}
+	}
+	if m.HasV2(){
+		if sha := sha256.Sum256(info); sha != m.InfoSHA256{
+			return fmt.Errorf("metadata hash mismatch: %x", sha)
+		}
+	}
+	return nil
+}
+
+//生成磁力链接，info hash使用十六进制，v2的种子使用btmh，hybrid种子两者都有
+func (m *Magnet) String() string{
+	var sb strings.Builder
+	sb.WriteString(magnetPrefix)
+	var xt []string
+	if !m.V2Only{
+		xt = append(xt, "xt=" + btihPrefix + hex.EncodeToString(m.InfoSHA[:]))
+	}
+	if m.HasV2(){
+		xt = append(xt, "xt=" + btmhPrefix + sha256Multihash + hex.EncodeToString(m.InfoSHA256[:]))
+	}
+	sb.WriteString(strings.Join(xt, "&"))
+	if m.Name != ""{
+		sb.WriteString("&dn=" + url.QueryEscape(m.Name))
+	}
+	for _, tr := range m.Trackers{
+		sb.WriteString("&tr=" + url.QueryEscape(tr))
+	}
+	for _, ws := range m.WebSeeds{
+		sb.WriteString("&ws=" + url.QueryEscape(ws))
+	}
+	for _, pe := range m.Peers{
+		sb.WriteString("&x.pe=" + url.QueryEscape(net.JoinHostPort(pe.Ip.String(), strconv.Itoa(int(pe.Port)))))
+	}
+	return sb.String()
+}
+
+//magnet中的tracker组成的TorrentFile，用于向tracker请求peer，每个tracker单独一层
+func (m *Magnet) trackerFile() *TorrentFile{
+	tf := &TorrentFile{InfoSHA: m.InfoSHA}
+	for _, tr := range m.Trackers{
+		tf.AnnounceList = append(tf.AnnounceList, []string{tr})
+	}
+	return tf
+}
+
+//由种子生成磁力链接，包含所有的tracker和web seed
+func (tf *TorrentFile) Magnet() *Magnet{
+	m := &Magnet{InfoSHA: tf.InfoSHA, Name: tf.FileName, WebSeeds: tf.WebSeeds}
+	if tf.HasV2(){
+		m.InfoSHA256 = tf.InfoSHA256
+		m.V2Only = !tf.HasV1()
+	}
+	seen := make(map[string]bool)
+	add := func(tr string){
+		if tr != "" && !seen[tr]{
+			seen[tr] = true
+			m.Trackers = append(m.Trackers, tr)
+		}
+	}
+	add(tf.Announce)
+	for _, tier := range tf.AnnounceList{
+		for _, tr := range tier{
+			add(tr)
+		}
+	}
+	return m
+}
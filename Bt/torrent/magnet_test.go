@@ -0,0 +1,97 @@
+package torrent
+
+import (
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+
+)
+
+func TestParseMagnet(t *testing.T) {
+	hash := "28c55196f57753c40aceb6fb58617e6995a7eddb"
+	uri := "magnet:?xt=urn:btih:" + hash + "&dn=debian-11.2.0-amd64-netinst.iso" +
+		"&tr=http%3A%2F%2Fbttracker.debian.org%3A6969%2Fannounce&tr=http%3A%2F%2Fb%2Fannounce" +
+		"&ws=http%3A%2F%2Fseed%2F&x.pe=127.0.0.1:6881&x.pe=%5B::1%5D:80&x.pe=bad"
+	m, err := ParseMagnet(uri)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, hash, hex.EncodeToString(m.InfoSHA[:]))
+	assert.Equal(t, "debian-11.2.0-amd64-netinst.iso", m.Name)
+	assert.Equal(t, []string{"http://bttracker.debian.org:6969/announce", "http://b/announce"}, m.Trackers)
+	assert.Equal(t, []string{"http://seed/"}, m.WebSeeds)
+	assert.Equal(t, 2, len(m.Peers))
+	assert.True(t, net.IPv4(127, 0, 0, 1).Equal(m.Peers[0].Ip))
+	assert.Equal(t, uint16(6881), m.Peers[0].Port)
+	assert.True(t, net.IPv6loopback.Equal(m.Peers[1].Ip))
+
+	//生成的链接可以解析回相同的内容
+	back, err := ParseMagnet(m.String())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, m, back)
+
+	//base32编码的info hash
+	m, err = ParseMagnet("magnet:?xt=urn:btih:FDCVDFXVO5J4ICWOW35VQYL6NGK2P3O3")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, hash, hex.EncodeToString(m.InfoSHA[:]))
+	m, err = ParseMagnet("magnet:?xt=urn:btih:fdcvdfxvo5j4icwow35vqyl6ngk2p3o3")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, hash, hex.EncodeToString(m.InfoSHA[:]))
+
+	for _, bad := range []string{
+		"http://a/",
+		"magnet:?dn=a",
+		"magnet:?xt=urn:btih:abc",
+		"magnet:?xt=urn:btih:zz c55196f57753c40aceb6fb58617e6995a7eddb",
+	} {
+		_, err = ParseMagnet(bad)
+		assert.NotEqual(t, nil, err, bad)
+	}
+}
+
+func TestTorrentFileMagnet(t *testing.T) {
+	tf := &TorrentFile{
+		Announce:     "http://a/",
+		AnnounceList: [][]string{{"http://a/", "http://b/"}, {"http://c/"}},
+		FileName:     "x y",
+		WebSeeds:     []string{"http://seed/"},
+	}
+	tf.InfoSHA[0] = 0xab
+	assert.Equal(t, "magnet:?xt=urn:btih:ab00000000000000000000000000000000000000&dn=x+y"+
+		"&tr=http%3A%2F%2Fa%2F&tr=http%3A%2F%2Fb%2F&tr=http%3A%2F%2Fc%2F&ws=http%3A%2F%2Fseed%2F", tf.Magnet().String())
+}
+
+func TestTorrentFileMagnetV2(t *testing.T) {
+	tf := &TorrentFile{FileName: "v2", MetaVersion: 2}
+	for i := range tf.InfoSHA256 {
+		tf.InfoSHA256[i] = byte(i)
+	}
+	copy(tf.InfoSHA[:], tf.InfoSHA256[:])
+	btmh := "xt=urn:btmh:1220" + hex.EncodeToString(tf.InfoSHA256[:])
+
+	//v2的种子只有btmh，InfoSHA是截断的SHA-256，不能作为btih
+	m := tf.Magnet()
+	assert.True(t, m.V2Only)
+	assert.Equal(t, "magnet:?" + btmh + "&dn=v2", m.String())
+	back, err := ParseMagnet(m.String())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, m, back)
+	assert.Equal(t, tf.InfoSHA, back.InfoSHA)
+
+	//hybrid种子两者都有
+	tf.PieceSHA = make([][SHALEN]byte, 1)
+	tf.InfoSHA = [SHALEN]byte{0xab}
+	m = tf.Magnet()
+	assert.False(t, m.V2Only)
+	assert.Equal(t, "magnet:?xt=urn:btih:ab00000000000000000000000000000000000000&" + btmh + "&dn=v2", m.String())
+	back, err = ParseMagnet(m.String())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, m, back)
+
+	for _, bad := range []string{
+		"magnet:?xt=urn:btmh:1220abcd",
+		"magnet:?xt=urn:btmh:1114" + hex.EncodeToString(tf.InfoSHA256[:]),
+	} {
+		_, err = ParseMagnet(bad)
+		assert.NotEqual(t, nil, err, bad)
+	}
+}
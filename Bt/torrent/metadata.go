@@ -0,0 +1,221 @@
+package torrent
+
+import (
+	"bytes"
+	"fmt"
+	"go_code/Bt/bencode"
+	"net"
+	"strconv"
+	"time"
+
+)
+
+/*
+	通过ut_metadata扩展(BEP 9)从peer获取种子的info：
+		1. 握手时设置扩展协议的标志，之后交换扩展握手消息(BEP 10)，得到对方ut_metadata的消息id和info的长度
+		2. info按16KB分成多块，逐块发送请求，对方回复的消息是一个bencode的dict，后面紧跟着这一块的数据
+		3. 所有块拼接后校验SHA，必须和磁力链接中的info hash一致(btih是SHA-1，btmh是SHA-256)
+*/
+
+const (
+	extHandshakeId byte = 0		//扩展握手消息的id
+	utMetadataId byte = 1		//本地ut_metadata消息的id，对方发给我们的消息使用这个id
+	metadataPieceLen = 16 * 1024
+	maxMetadataSize = 16 << 20
+)
+
+//ut_metadata的消息类型
+const (
+	metadataRequest = 0
+	metadataData = 1
+	metadataReject = 2
+)
+
+//peer发来的扩展消息不可信，解码时限制资源
+var extDecodeOpts = bencode.DecoderOptions{
+	MaxDepth:		8,
+	MaxStringLen:	1 << 20,
+	MaxBytes:		1 << 20,
+	MaxEntries:		1024,
+}
+
+//扩展握手消息，m是扩展名到消息id的映射
+type extHandshake struct {
+	M				map[string]int	`bencode:"m"`
+	MetadataSize	int				`bencode:"metadata_size,omitempty"`
+}
+
+type metadataMsg struct {
+	MsgType		int	`bencode:"msg_type"`
+	Piece		int	`bencode:"piece"`
+	TotalSize	int	`bencode:"total_size,omitempty"`
+}
+
+//向m中的tracker和x.pe请求peer，再从peer获取info
+func (m *Magnet) FetchTorrent(peerId [IDLEN]byte) (*TorrentFile, error){
+	//private在info中，获取到info之前不知道是不是私有种子，所以x.pe中的peer也用来获取info：
+	//这是有意的，info按info hash校验，x.pe中的peer只用于获取info；下载时再由AddPeers按private决定是否使用
+	peers := append([]PeerInfo(nil), m.Peers...)
+	if len(m.Trackers) > 0{
+		peers = append(peers, FindPeers(m.trackerFile(), peerId)...)
+	}
+	if len(peers) == 0{
+		return nil, fmt.Errorf("can not find peers")
+	}
+	return FetchMetadata(m, peers, peerId)
+}
+
+//依次从peers获取info，直到有一个peer返回了正确的info，生成的TorrentFile包含m中的tracker和web seed
+func FetchMetadata(m *Magnet, peers []PeerInfo, peerId [IDLEN]byte) (*TorrentFile, error){
+	var err error
+	for _, peer := range peers{
+		var info []byte
+		info, err = fetchFromPeer(peer, m, peerId)
+		if err != nil{
+			fmt.Println("fail to fetch metadata from peer " + peer.Ip.String() + ": " + err.Error())
+			continue
+		}
+		raw := &rawFile{Info: info, URLList: m.WebSeeds}
+		raw.AnnounceList = m.trackerFile().AnnounceList
+		if len(m.Trackers) > 0{
+			raw.Announce = m.Trackers[0]
+		}
+		return newTorrentFile(raw)
+	}
+	if err == nil{
+		err = fmt.Errorf("no peers")
+	}
+	return nil, err
+}
+
+func fetchFromPeer(peer PeerInfo, m *Magnet, peerId [IDLEN]byte) ([]byte, error){
+	addr := net.JoinHostPort(peer.Ip.String(), strconv.Itoa(int(peer.Port)))
+	conn, err := net.DialTimeout("tcp", addr, 5 * time.Second)
+	if err != nil{
+		return nil, err
+	}
+	defer conn.Close()
+	return fetchMetadata(conn, m, peerId)
+}
+
+//在conn上完成握手并获取info，握手使用m.InfoSHA，获取后按m中的info hash校验
+func fetchMetadata(conn net.Conn, m *Magnet, peerId [IDLEN]byte) ([]byte, error){
+	req := NewHandshakeMsg(m.InfoSHA, peerId)
+	req.SetExtended()
+	res, err := handshake(conn, req)
+	if err != nil{
+		return nil, err
+	}
+	if !res.SupportsExtended(){
+		return nil, fmt.Errorf("peer does not support extension protocol")
+	}
+
+	pc := &PeerConn{Conn: conn}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	defer conn.SetDeadline(time.Time{})
+
+	//交换扩展握手消息
+	err = writeExtMsg(pc, extHandshakeId, &extHandshake{M: map[string]int{"ut_metadata": int(utMetadataId)}})
+	if err != nil{
+		return nil, err
+	}
+	id, payload, err := readExtMsg(pc)
+	for err == nil && id != extHandshakeId{
+		id, payload, err = readExtMsg(pc)
+	}
+	if err != nil{
+		return nil, err
+	}
+	hs := new(extHandshake)
+	if err := extDecodeOpts.UnmarshalBytes(payload, hs); err != nil{
+		return nil, err
+	}
+	peerMetaId, ok := hs.M["ut_metadata"]
+	if !ok || peerMetaId <= 0 || peerMetaId > 255{
+		return nil, fmt.Errorf("peer does not support ut_metadata")
+	}
+	size := hs.MetadataSize
+	if size <= 0 || size > maxMetadataSize{
+		return nil, fmt.Errorf("invalid metadata size %d", size)
+	}
+
+	//一次性请求所有块
+	cnt := (size + metadataPieceLen - 1) / metadataPieceLen
+	for i := 0; i < cnt; i++{
+		err := writeExtMsg(pc, byte(peerMetaId), &metadataMsg{MsgType: metadataRequest, Piece: i})
+		if err != nil{
+			return nil, err
+		}
+	}
+
+	info := make([]byte, size)
+	got := make([]bool, cnt)
+	for remain := cnt; remain > 0;{
+		id, payload, err := readExtMsg(pc)
+		if err != nil{
+			return nil, err
+		}
+		if id != utMetadataId{
+			continue
+		}
+		//payload是一个dict，后面紧跟着这一块的数据
+		dec := extDecodeOpts.NewDecoder(bytes.NewReader(payload))
+		msg := new(metadataMsg)
+		if err := dec.Decode(msg); err != nil{
+			return nil, err
+		}
+		if msg.MsgType == metadataReject{
+			return nil, fmt.Errorf("peer rejected metadata piece %d", msg.Piece)
+		}
+		if msg.MsgType != metadataData{
+			continue
+		}
+		if msg.Piece < 0 || msg.Piece >= cnt || got[msg.Piece]{
+			return nil, fmt.Errorf("unexpected metadata piece %d", msg.Piece)
+		}
+		begin := msg.Piece * metadataPieceLen
+		end := begin + metadataPieceLen
+		if end > size{
+			end = size
+		}
+		data := payload[dec.InputOffset():]
+		if len(data) != end - begin{
+			return nil, fmt.Errorf("metadata piece %d has length %d, expect %d", msg.Piece, len(data), end - begin)
+		}
+		copy(info[begin:end], data)
+		got[msg.Piece] = true
+		remain--
+	}
+
+	if err := m.checkInfo(info); err != nil{
+		return nil, err
+	}
+	return info, nil
+}
+
+//发送扩展消息：1byte的扩展消息id + bencode编码的v
+func writeExtMsg(pc *PeerConn, id byte, v interface{}) error{
+	buf := bytes.NewBuffer([]byte{id})
+	if _, err := bencode.Marshal(buf, v); err != nil{
+		return err
+	}
+	_, err := pc.WriteMsg(&PeerMsg{MsgExtended, buf.Bytes()})
+	return err
+}
+
+//读取下一个扩展消息，跳过其他消息
+func readExtMsg(pc *PeerConn) (byte, []byte, error){
+	for{
+		msg, err := pc.ReadMsg()
+		if err != nil{
+			return 0, nil, err
+		}
+		if msg == nil || msg.Id != MsgExtended{
+			continue
+		}
+		if len(msg.Payload) == 0{
+			return 0, nil, fmt.Errorf("empty extended message")
+		}
+		return msg.Payload[0], msg.Payload[1:], nil
+	}
+}
@@ -0,0 +1,126 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"github.com/stretchr/testify/assert"
+	"go_code/Bt/bencode"
+	"net"
+	"testing"
+
+)
+
+//模拟一个支持ut_metadata的peer，reject为true时拒绝所有请求
+func serveMetadata(t *testing.T, info []byte, reject bool) PeerInfo {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Equal(t, nil, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		req, err := ReadHandShake(conn)
+		if err != nil {
+			return
+		}
+		res := NewHandshakeMsg(req.InfoSHA, [IDLEN]byte{})
+		res.SetExtended()
+		WriteHandShake(conn, res)
+		pc := &PeerConn{Conn: conn}
+		pc.WriteMsg(&PeerMsg{MsgBitfield, []byte{0xff}})
+
+		const peerMetaId = 3
+		//等待对方的扩展握手，得到对方ut_metadata的id
+		id, payload, err := readExtMsg(pc)
+		if err != nil || id != extHandshakeId {
+			return
+		}
+		hs := new(extHandshake)
+		bencode.UnmarshalBytes(payload, hs)
+		remoteId := byte(hs.M["ut_metadata"])
+		writeExtMsg(pc, extHandshakeId, &extHandshake{
+			M:            map[string]int{"ut_metadata": peerMetaId},
+			MetadataSize: len(info),
+		})
+		for {
+			id, payload, err := readExtMsg(pc)
+			if err != nil {
+				return
+			}
+			if id != peerMetaId {
+				continue
+			}
+			msg := new(metadataMsg)
+			bencode.UnmarshalBytes(payload, msg)
+			if reject {
+				writeExtMsg(pc, remoteId, &metadataMsg{MsgType: metadataReject, Piece: msg.Piece})
+				continue
+			}
+			begin := msg.Piece * metadataPieceLen
+			end := begin + metadataPieceLen
+			if end > len(info) {
+				end = len(info)
+			}
+			buf := bytes.NewBuffer([]byte{remoteId})
+			bencode.Marshal(buf, &metadataMsg{MsgType: metadataData, Piece: msg.Piece, TotalSize: len(info)})
+			buf.Write(info[begin:end])
+			pc.WriteMsg(&PeerMsg{MsgExtended, buf.Bytes()})
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	return PeerInfo{Ip: addr.IP, Port: uint16(addr.Port)}
+}
+
+func TestFetchMetadata(t *testing.T) {
+	//info超过16KB，需要分两块获取
+	length := 1000 * 16384
+	raw := &rawInfo{Name: "a", Length: &length, PieceLength: 16384, Pieces: make(PieceHashes, 1000)}
+	buf := new(bytes.Buffer)
+	_, err := bencode.Marshal(buf, raw)
+	assert.Equal(t, nil, err)
+	info := buf.Bytes()
+	assert.True(t, len(info) > metadataPieceLen)
+
+	m := &Magnet{InfoSHA: sha1.Sum(info), Trackers: []string{"http://a/"}, WebSeeds: []string{"http://seed/"}}
+	var peerId [IDLEN]byte
+	rejecting := serveMetadata(t, info, true)
+	good := serveMetadata(t, info, false)
+	tf, err := FetchMetadata(m, []PeerInfo{rejecting, good}, peerId)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, m.InfoSHA, tf.InfoSHA)
+	assert.Equal(t, "a", tf.FileName)
+	assert.Equal(t, 1000 * 16384, tf.FileLen)
+	assert.Equal(t, 1000, len(tf.PieceSHA))
+	assert.Equal(t, "http://a/", tf.Announce)
+	assert.Equal(t, []string{"http://seed/"}, tf.WebSeeds)
+
+	//peer返回的info和info hash不一致
+	m.InfoSHA[0]++
+	_, err = FetchMetadata(m, []PeerInfo{serveMetadata(t, info, false)}, peerId)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestFetchMetadataV2(t *testing.T) {
+	//只有btmh的磁力链接：握手使用截断的SHA-256，按SHA-256校验info
+	tree, _ := v2Tree()
+	raw := &rawInfo{Name: "v2", PieceLength: v2PieceLen, MetaVersion: 2, FileTree: tree[2:]}
+	buf := new(bytes.Buffer)
+	_, err := bencode.Marshal(buf, raw)
+	assert.Equal(t, nil, err)
+	info := buf.Bytes()
+
+	m := &Magnet{InfoSHA256: sha256.Sum256(info), V2Only: true}
+	copy(m.InfoSHA[:], m.InfoSHA256[:])
+	var peerId [IDLEN]byte
+	tf, err := FetchMetadata(m, []PeerInfo{serveMetadata(t, info, false)}, peerId)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, m.InfoSHA256, tf.InfoSHA256)
+	assert.Equal(t, m.InfoSHA, tf.InfoSHA)
+
+	m.InfoSHA256[0]++
+	_, err = FetchMetadata(m, []PeerInfo{serveMetadata(t, info, false)}, peerId)
+	assert.NotEqual(t, nil, err)
+}
@@ -30,6 +30,7 @@ const (
 	MsgRequest     MsgId = 6	//下载请求：指定下载的pieces，起始位置start，下载的长度
 	MsgPiece       MsgId = 7	//返回请求要的piece的byte
 	MsgCancel      MsgId = 8
+	MsgExtended    MsgId = 20	//扩展协议的消息(BEP 10)，payload第一个byte是扩展消息的id
 )
 
 type PeerMsg struct{
@@ -57,7 +58,7 @@ func NewConn(peerInfo PeerInfo, infoSHA [SHALEN]byte, peerId [IDLEN]byte)(*PeerC
 	}
 
 	//握手
-	err = handshake(tcpconn, infoSHA, peerId)
+	_, err = handshake(tcpconn, NewHandshakeMsg(infoSHA, peerId))
 	if err != nil{
 		fmt.Println("handshake failed")
 		tcpconn.Close()
@@ -81,31 +82,30 @@ func NewConn(peerInfo PeerInfo, infoSHA [SHALEN]byte, peerId [IDLEN]byte)(*PeerC
 	return peerConn, nil
 }
 
-//握手
-func handshake(tcpconn net.Conn, infoSHA [SHALEN]byte, peerId [IDLEN]byte) error{
+//握手，返回对方的握手消息
+func handshake(tcpconn net.Conn, req *HandshakeMsg) (*HandshakeMsg, error){
 	//设置超时时间
 	tcpconn.SetDeadline(time.Now().Add(3 * time.Second))
 	defer tcpconn.SetDeadline(time.Time{})
-	//1. 通过infoSHA和peerId，生成握手消息
-	req := NewHandshakeMsg(infoSHA, peerId)
+	//1. 发送握手消息(由infoSHA和peerId生成)
 	_, err := WriteHandShake(tcpconn, req)
 	if err != nil{
 		fmt.Println("send handshake failed")
-		return err
+		return nil, err
 	}
 	//读取回复的握手消息
 	res, err := ReadHandShake(tcpconn)
 	if err != nil{
 		fmt.Println("read handshake failed")
-		return err
+		return nil, err
 	}
 
 	//
-	if !bytes.Equal(res.InfoSHA[:], infoSHA[:]){
+	if !bytes.Equal(res.InfoSHA[:], req.InfoSHA[:]){
 		fmt.Println("check handshake failed")
-		return fmt.Errorf("handshake msg error: " + string(res.InfoSHA[:]))
+		return nil, fmt.Errorf("handshake msg error: %x", res.InfoSHA[:])
 	}
-	return nil
+	return res, nil
 }
 
 //发送一个peerMsg，获取对端的BitField(资源拥有情况)
@@ -124,7 +124,7 @@ func fillBitfield(peerConn *PeerConn) error{
 	}
 
 	if msg.Id != MsgBitfield{
-		return fmt.Errorf("expected bitfield, get " + strconv.Itoa(int(msg.Id)))
+		return fmt.Errorf("expected bitfield, get %d", msg.Id)
 	}
 	fmt.Println("fill bitfield : " + peerConn.peer.Ip.String())
 	peerConn.bitField = msg.Payload
@@ -0,0 +1,65 @@
+package torrent
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+)
+
+/*
+	私有种子(BEP 27)：info中private为1
+		1. 只能从种子自己的tracker获取peer，手动分享的peer(例如磁力链接中的x.pe)不能使用；这里没有实现DHT、PEX和LSD
+		2. private在info中，改变它会改变info hash，所以info必须保留原始编码，不能丢掉这个key
+	所有tracker之外的peer都要通过AddPeers合并，由它统一检查
+*/
+
+//peer的来源
+type PeerSource int
+
+const (
+	PeerFromTracker PeerSource = iota
+	PeerFromCache		//手动分享的peer，例如磁力链接中的x.pe
+)
+
+func (src PeerSource) String() string{
+	switch src {
+	case PeerFromTracker:
+		return "tracker"
+	case PeerFromCache:
+		return "peer cache"
+	}
+	return "unknown source " + strconv.Itoa(int(src))
+}
+
+//是否可以使用来自src的peer，私有种子只能使用tracker
+func (tf *TorrentFile) AllowPeerSource(src PeerSource) bool{
+	return !tf.Private || src == PeerFromTracker
+}
+
+//把来自src的peer合并到peers中并去重，不允许使用的来源直接忽略
+func (tf *TorrentFile) AddPeers(peers []PeerInfo, src PeerSource, add []PeerInfo) []PeerInfo{
+	if len(add) == 0{
+		return peers
+	}
+	if !tf.AllowPeerSource(src){
+		fmt.Printf("private torrent, ignore %d peers from %s\n", len(add), src)
+		return peers
+	}
+	seen := make(map[string]bool, len(peers))
+	for _, peer := range peers{
+		seen[peerKey(peer)] = true
+	}
+	for _, peer := range add{
+		key := peerKey(peer)
+		if !seen[key]{
+			seen[key] = true
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+func peerKey(peer PeerInfo) string{
+	return net.JoinHostPort(peer.Ip.String(), strconv.Itoa(int(peer.Port)))
+}
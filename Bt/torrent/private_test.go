@@ -0,0 +1,53 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+
+)
+
+func TestPrivateInfoHash(t *testing.T) {
+	//private是info的一部分，改变它会改变info hash
+	public := "d6:lengthi5e4:name3:abc12:piece lengthi16384e6:pieces20:aaaaaaaaaaaaaaaaaaaae"
+	private := "d6:lengthi5e4:name3:abc12:piece lengthi16384e6:pieces20:aaaaaaaaaaaaaaaaaaaa7:privatei1ee"
+	tf1, err := ParseFile(bytes.NewBufferString("d8:announce9:http://a/4:info" + public + "e"))
+	assert.Equal(t, nil, err)
+	assert.False(t, tf1.Private)
+	tf2, err := ParseFile(bytes.NewBufferString("d8:announce9:http://a/4:info" + private + "e"))
+	assert.Equal(t, nil, err)
+	assert.True(t, tf2.Private)
+	assert.Equal(t, sha1.Sum([]byte(private)), tf2.InfoSHA)
+	assert.NotEqual(t, tf1.InfoSHA, tf2.InfoSHA)
+
+	//编辑后仍然是私有种子，info hash不变
+	out := new(bytes.Buffer)
+	tf3, err := EditTorrent(bytes.NewBufferString("d8:announce9:http://a/4:info" + private + "e"), out,
+		EditOptions{Trackers: [][]string{{"http://b/"}}, ReplaceTrackers: true})
+	assert.Equal(t, nil, err)
+	assert.True(t, tf3.Private)
+	assert.Equal(t, tf2.InfoSHA, tf3.InfoSHA)
+	assert.True(t, bytes.Contains(out.Bytes(), []byte("7:privatei1e")))
+}
+
+func TestAddPeers(t *testing.T) {
+	a := PeerInfo{Ip: net.ParseIP("1.2.3.4"), Port: 6881}
+	b := PeerInfo{Ip: net.ParseIP("5.6.7.8"), Port: 6881}
+	c := PeerInfo{Ip: net.ParseIP("1.2.3.4"), Port: 6882}
+
+	tf := &TorrentFile{}
+	for _, src := range []PeerSource{PeerFromTracker, PeerFromCache} {
+		assert.True(t, tf.AllowPeerSource(src), src.String())
+	}
+	peers := tf.AddPeers([]PeerInfo{a}, PeerFromCache, []PeerInfo{b, a, c, b})
+	assert.Equal(t, []PeerInfo{a, b, c}, peers)
+
+	//私有种子只接受tracker返回的peer
+	tf.Private = true
+	assert.True(t, tf.AllowPeerSource(PeerFromTracker))
+	assert.False(t, tf.AllowPeerSource(PeerFromCache))
+	assert.Equal(t, []PeerInfo{a}, tf.AddPeers([]PeerInfo{a}, PeerFromCache, []PeerInfo{b}))
+	assert.Equal(t, []PeerInfo{a, b}, tf.AddPeers([]PeerInfo{a}, PeerFromTracker, []PeerInfo{b}))
+}
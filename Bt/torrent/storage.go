@@ -0,0 +1,105 @@
+package torrent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+)
+
+//下载到本地的一个文件，offset是它在所有文件首尾相接后的数据中的起始位置
+type storageFile struct {
+	file	*os.File
+	offset	int
+	length	int
+}
+
+/*
+	把piece写入本地文件：
+		单文件种子只有一个文件，路径为FileName
+		多文件种子的文件都放在以FileName命名的根目录下，v1中的填充文件不创建
+		FileName的最后一级和文件路径中的每一级都经过sanitizeName清理
+	piece按它在整体数据中的位置写入，跨越文件边界时拆分写入多个文件
+*/
+type storage struct {
+	files	[]storageFile
+}
+
+//是否是单文件种子：v2的单文件种子在file tree中也只有一个文件，同样直接使用FileName
+func (task *TorrentTask) singleFile() bool{
+	return len(task.Files) == 0 || (task.V2 && len(task.Files) == 1 && len(task.Files[0].Path) == 1)
+}
+
+//创建所有文件(包括中间的目录)，并把每个文件的大小设为最终大小
+func openStorage(task *TorrentTask) (*storage, error){
+	files := task.Files
+	if len(files) == 0{
+		files = []FileInfo{{Path: []string{task.FileName}, Length: task.FileLen}}
+	}
+	single := task.singleFile()
+	//FileName的最后一级和文件路径来自种子，清理后才能使用
+	root := filepath.Join(filepath.Dir(task.FileName), sanitizeName(filepath.Base(task.FileName)))
+	s := &storage{files: make([]storageFile, 0, len(files))}
+	for _, f := range files{
+		//填充文件不写到本地，WriteAt时跳过它对应的数据
+		if f.Padding{
+			continue
+		}
+		path := filepath.Join(root, sanitizePath(f.Path))
+		if single{
+			path = root
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil{
+			s.Close()
+			return nil, err
+		}
+		file, err := os.Create(path)
+		if err != nil{
+			s.Close()
+			return nil, err
+		}
+		s.files = append(s.files, storageFile{file, f.Offset, f.Length})
+		if err := file.Truncate(int64(f.Length)); err != nil{
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+//把从offset开始的data写入对应的文件
+func (s *storage) WriteAt(data []byte, offset int) error{
+	end := offset + len(data)
+	for _, f := range s.files{
+		fend := f.offset + f.length
+		if fend <= offset || f.offset >= end{
+			continue
+		}
+		//data和这个文件重叠的部分
+		begin := offset
+		if begin < f.offset{
+			begin = f.offset
+		}
+		stop := end
+		if stop > fend{
+			stop = fend
+		}
+		_, err := f.file.WriteAt(data[begin - offset : stop - offset], int64(begin - f.offset))
+		if err != nil{
+			return fmt.Errorf("fail to write %s: %w", f.file.Name(), err)
+		}
+	}
+	return nil
+}
+
+//关闭所有文件，可以重复调用
+func (s *storage) Close() error{
+	var ret error
+	for _, f := range s.files{
+		if err := f.file.Close(); err != nil && ret == nil{
+			ret = err
+		}
+	}
+	s.files = nil
+	return ret
+}
@@ -0,0 +1,55 @@
+package torrent
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+
+)
+
+func TestStorageMultiFile(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "root")
+	task := &TorrentTask{
+		FileName: root,
+		FileLen:  10,
+		Files: []FileInfo{
+			{Path: []string{"a", "b.txt"}, Length: 3, Offset: 0},
+			{Path: []string{"empty"}, Length: 0, Offset: 3},
+			{Path: []string{"c"}, Length: 7, Offset: 3},
+		},
+		PieceLen: 4,
+	}
+	s, err := openStorage(task)
+	assert.Equal(t, nil, err)
+	//piece的写入顺序是乱的，第0个piece跨越了3个文件
+	for _, index := range []int{2, 0, 1} {
+		begin, end := task.getPieceBounds(index)
+		assert.Equal(t, nil, s.WriteAt([]byte("0123456789"[begin:end]), begin))
+	}
+	assert.Equal(t, nil, s.Close())
+	assert.Equal(t, nil, s.Close())
+
+	data, err := os.ReadFile(filepath.Join(root, "a", "b.txt"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "012", string(data))
+	data, err = os.ReadFile(filepath.Join(root, "empty"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "", string(data))
+	data, err = os.ReadFile(filepath.Join(root, "c"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "3456789", string(data))
+}
+
+func TestStorageSingleFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "single.iso")
+	task := &TorrentTask{FileName: name, FileLen: 5, PieceLen: 4}
+	s, err := openStorage(task)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, s.WriteAt([]byte("4"), 4))
+	assert.Equal(t, nil, s.WriteAt([]byte("0123"), 0))
+	assert.Equal(t, nil, s.Close())
+	data, err := os.ReadFile(name)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "01234", string(data))
+}
@@ -3,35 +3,167 @@ package torrent
 import (
 	"bytes"
 	"crypto/sha1"
+	"crypto/sha256"
 	"fmt"
 	"go_code/Bt/bencode"
 	"io"
+	"strings"
+	"time"
 
 )
 
+//单文件的种子只有length，多文件的种子只有files
+//v2的种子只有meta version和file tree，hybrid种子两者都有
 type rawInfo struct {
-	Length 			int		`bencode:"length"`
-	Name			string	`bencode:"name"`
-	PieceLength		int		`bencode:"piece length"`
-	Pieces			string	`bencode:"pieces"`
+	Length 			*int			`bencode:"length,omitempty"`	//指针：区分没有length和空文件的length 0
+	Files			[]rawFileEntry	`bencode:"files,omitempty"`
+	Name			string			`bencode:"name"`
+	PieceLength		int				`bencode:"piece length"`
+	Pieces			PieceHashes		`bencode:"pieces,omitempty"`
+	Private			int				`bencode:"private,omitempty"`
+	MetaVersion		int				`bencode:"meta version,omitempty"`
+	FileTree		fileTree		`bencode:"file tree,omitempty"`
+}
+
+//多文件种子中的一个文件，path是相对于根目录(info.name)的各级目录名和文件名
+type rawFileEntry struct {
+	Attr	string		`bencode:"attr,omitempty"`	//包含'p'时是对齐用的填充文件(BEP 47)
+	Length	int			`bencode:"length"`
+	Path	[]string	`bencode:"path"`
+}
+
+//pieces是所有piece的SHA首尾相接组成的string，每SHALEN个byte一个
+type PieceHashes [][SHALEN]byte
+
+func (hashes *PieceHashes) UnmarshalBencode(data []byte) error{
+	str, err := bencode.DecodeString(bytes.NewReader(data))
+	if err != nil{
+		return err
+	}
+	bys := []byte(str)
+	if len(bys) % SHALEN != 0{
+		return fmt.Errorf("malformed pieces, length %d is not a multiple of %d", len(bys), SHALEN)
+	}
+	cnt := len(bys) / SHALEN
+	ret := make(PieceHashes, cnt)
+	for i := 0; i < cnt; i++{
+		copy(ret[i][:], bys[i * SHALEN : (i + 1) * SHALEN])
+	}
+	*hashes = ret
+	return nil
+}
+
+func (hashes PieceHashes) MarshalBencode() ([]byte, error){
+	bys := make([]byte, 0, len(hashes) * SHALEN)
+	for _, sha := range hashes{
+		bys = append(bys, sha[:]...)
+	}
+	buf := new(bytes.Buffer)
+	_, err := bencode.EncodeString(buf, string(bys))
+	return buf.Bytes(), err
 }
 
 //未经过加工的种子文件
+//info保留原始编码：InfoSHA必须是文件中info原始字节的SHA，重新编码会丢掉rawInfo中没有的key
 type rawFile struct {
-	Announce string		`bencode:"announce"`	//tracker的URL
-	Info 	rawInfo		`bencode:"info"`
+	Announce 		string				`bencode:"announce,omitempty"`	//tracker的URL
+	AnnounceList	[][]string			`bencode:"announce-list,omitempty"`	//分层的tracker列表(BEP 12)
+	Comment			string				`bencode:"comment,omitempty"`
+	CreatedBy		string				`bencode:"created by,omitempty"`
+	CreationDate	int64				`bencode:"creation date,omitempty"`	//unix时间戳
+	URLList			urlList				`bencode:"url-list,omitempty"`	//web seed(BEP 19)
+	HTTPSeeds		[]string			`bencode:"httpseeds,omitempty"`	//http seed(BEP 17)
+	Info 			bencode.RawMessage	`bencode:"info"`
+	PieceLayers		map[string]string	`bencode:"piece layers,omitempty"`	//v2：pieces root -> 各piece的节点
+}
+
+//url-list可以是一个string，也可以是string组成的list
+type urlList []string
+
+func (l *urlList) UnmarshalBencode(data []byte) error{
+	obj, err := bencode.ParseBytes(data)
+	if err != nil{
+		return err
+	}
+	if str, err := obj.Str(); err == nil{
+		*l = nil
+		if str != ""{
+			*l = urlList{str}
+		}
+		return nil
+	}
+	var urls []string
+	err = bencode.UnmarshalBytes(data, &urls)
+	if err != nil{
+		return err
+	}
+	*l = urls
+	return nil
 }
 
 const SHALEN int = 20
 
 type TorrentFile struct{
 	Announce 	string			//tracker的URL
-	InfoSHA 	[SHALEN]byte	//File的唯一标识
-	FileName 	string			//制作本地文件时的文件名
-	FileLen 	int				//tracker交互、校验用到。根据filelen可以计算还需下载多少。。
+	AnnounceList	[][]string	//分层的tracker列表，为空时只使用Announce
+	Comment		string
+	CreatedBy	string
+	CreationDate	time.Time	//没有creation date时为零值
+	WebSeeds	[]string		//url-list中的web seed
+	HTTPSeeds	[]string		//httpseeds中的http seed
+	MetaVersion	int				//1或2，hybrid种子为2
+	Private		bool			//私有种子(BEP 27)，private在info中，改变它会改变info hash
+	InfoSHA 	[SHALEN]byte	//File的唯一标识，v2的种子是InfoSHA256的前20byte
+	InfoSHA256	[SHA256LEN]byte	//v2的info hash，v1的种子为零值
+	FileName 	string			//制作本地文件时的文件名，多文件时是根目录名
+	FileLen 	int				//tracker交互、校验用到。根据filelen可以计算还需下载多少。。多文件时是所有文件的总长度
+	Files		[]FileInfo		//多文件种子中的文件，单文件种子为空
 	//以下两个字段是校验时用到的
 	PieceLen 	int
-	PieceSHA 	[][SHALEN]byte
+	PieceSHA 	[][SHALEN]byte	//v1的piece的SHA，v2的种子为空，使用Files中的merkle树校验
+	trackers	*TrackerList	//FindPeers使用的tracker顺序，第一次请求时创建
+}
+
+//多文件种子中的一个文件
+//所有文件按顺序首尾相接后再切分成piece，Offset是文件在其中的起始位置，一个piece可能跨越多个文件
+//v2的种子中每个文件的Offset都对齐到piece长度，piece不会跨越文件
+type FileInfo struct {
+	Path	[]string	//相对于根目录的各级目录名和文件名
+	Length	int
+	Offset	int
+	Padding	bool		//v1中对齐用的填充文件，内容全为0，不需要写到本地
+	PiecesRoot	[SHA256LEN]byte		//v2：文件的merkle树的根，空文件为零值
+	PieceLayer	[][SHA256LEN]byte	//v2：每个piece对应的树节点，不超过一个piece的文件为空
+}
+
+//分层的tracker列表，没有announce-list时只有announce一层
+func (tf *TorrentFile) Tiers() [][]string{
+	if len(tf.AnnounceList) == 0 && tf.Announce != ""{
+		return [][]string{{tf.Announce}}
+	}
+	return tf.AnnounceList
+}
+
+//piece的个数，v2的种子按每个文件单独切分计算
+func (tf *TorrentFile) PieceCount() int{
+	if tf.HasV1(){
+		return len(tf.PieceSHA)
+	}
+	cnt := 0
+	for _, f := range tf.Files{
+		cnt += (f.Length + tf.PieceLen - 1) / tf.PieceLen
+	}
+	return cnt
+}
+
+//是否包含v1的数据
+func (tf *TorrentFile) HasV1() bool{
+	return tf.MetaVersion != 2 || len(tf.PieceSHA) > 0
+}
+
+//是否包含v2的数据
+func (tf *TorrentFile) HasV2() bool{
+	return tf.MetaVersion == 2
 }
 
 func ParseFile(r io.Reader)(*TorrentFile, error){
@@ -41,30 +173,125 @@ func ParseFile(r io.Reader)(*TorrentFile, error){
 		fmt.Println("Fail to parse torrent file")
 		return nil, err
 	}
+	return newTorrentFile(raw)
+}
+
+//由解析好的种子文件生成TorrentFile
+func newTorrentFile(raw *rawFile) (*TorrentFile, error){
+	if len(raw.Info) == 0{
+		fmt.Println("raw file info error")
+		return nil, fmt.Errorf("torrent file has no info")
+	}
+	info := new(rawInfo)
+	err := bencode.Unmarshal(bytes.NewReader(raw.Info), info)
+	if err != nil{
+		fmt.Println("Fail to parse torrent info")
+		return nil, err
+	}
 
 	ret := new(TorrentFile)
 	ret.Announce = raw.Announce
-	ret.FileName = raw.Info.Name
-	ret.FileLen = raw.Info.Length
-	ret.PieceLen = raw.Info.PieceLength
-
-	//计算info的SHA
-	buf := new(bytes.Buffer)
-	wlen := bencode.Marshal(buf, raw.Info)
-	if wlen == 0{
-		fmt.Println("raw file info error")
+	ret.AnnounceList = cleanTiers(raw.AnnounceList)
+	ret.Comment = raw.Comment
+	ret.CreatedBy = raw.CreatedBy
+	if raw.CreationDate != 0{
+		ret.CreationDate = time.Unix(raw.CreationDate, 0)
+	}
+	ret.WebSeeds = raw.URLList
+	ret.HTTPSeeds = raw.HTTPSeeds
+	ret.FileName = info.Name
+	ret.PieceLen = info.PieceLength
+	//v1的info中length(单文件)和files(多文件)有且只有一个，只有v2数据时两者都没有
+	if info.Length != nil && len(info.Files) > 0{
+		return nil, fmt.Errorf("torrent info has both length and files")
+	}
+	if info.Length == nil && len(info.Files) == 0 && info.MetaVersion != 2{
+		return nil, fmt.Errorf("torrent info has neither length nor files")
+	}
+	if info.Length != nil{
+		ret.FileLen = *info.Length
+	}
+	if len(info.Files) > 0{
+		ret.Files, ret.FileLen, err = buildFiles(info.Files)
+		if err != nil{
+			return nil, err
+		}
 	}
-	ret.InfoSHA = sha1.Sum(buf.Bytes())
 
-	// 计算pieces的SHA
-	bys := []byte(raw.Info.Pieces)
-	cnt := len(bys) / SHALEN
-	hashes := make([][SHALEN]byte,cnt)
-	for i := 0; i < cnt; i++{
-		copy(hashes[i][:], bys[i * SHALEN : (i + 1) * SHALEN])
+	//计算info的SHA：直接对原始字节计算
+	ret.InfoSHA = sha1.Sum(raw.Info)
+	ret.PieceSHA = info.Pieces
+	ret.MetaVersion = 1
+	ret.Private = info.Private == 1
+	if info.MetaVersion == 2{
+		err = ret.parseV2(info, raw)
+		if err != nil{
+			return nil, err
+		}
 	}
-	ret.PieceSHA =hashes
 
+	err = ret.Validate()
+	if err != nil{
+		return nil, err
+	}
 	return ret, nil
+}
+
+//解析v2的数据；只有v2数据时用file tree代替v1的文件，hybrid种子检查两者是否一致
+func (tf *TorrentFile) parseV2(info *rawInfo, raw *rawFile) error{
+	files, total, err := buildV2Files(info.FileTree, raw.PieceLayers, info.PieceLength)
+	if err != nil{
+		return err
+	}
+	tf.MetaVersion = 2
+	tf.InfoSHA256 = sha256.Sum256(raw.Info)
+	hybrid := len(info.Pieces) > 0 || info.Length != nil || len(info.Files) > 0
+	if !hybrid{
+		copy(tf.InfoSHA[:], tf.InfoSHA256[:SHALEN])
+		tf.Files = files
+		tf.FileLen = total
+		return nil
+	}
+	if len(tf.Files) == 0{
+		//单文件：file tree中只有一个和name同名的文件
+		if len(files) != 1 || !equalPath(files[0].Path, []string{info.Name}) || files[0].Length != tf.FileLen{
+			return fmt.Errorf("hybrid torrent has inconsistent v1 and v2 files")
+		}
+		return nil
+	}
+	return mergeHybridFiles(tf.Files, files)
+}
+
+//计算每个文件的偏移和所有文件的总长度
+func buildFiles(entries []rawFileEntry) ([]FileInfo, int, error){
+	files := make([]FileInfo, len(entries))
+	offset := 0
+	for i, e := range entries{
+		if len(e.Path) == 0{
+			return nil, 0, fmt.Errorf("file %d has empty path", i)
+		}
+		if e.Length < 0{
+			return nil, 0, fmt.Errorf("file %d has negative length %d", i, e.Length)
+		}
+		files[i] = FileInfo{Path: e.Path, Length: e.Length, Offset: offset, Padding: strings.Contains(e.Attr, "p")}
+		offset += e.Length
+	}
+	return files, offset, nil
+}
 
-}
\ No newline at end of file
+//去掉announce-list中空的URL和空的层
+func cleanTiers(tiers [][]string) [][]string{
+	var ret [][]string
+	for _, tier := range tiers{
+		var urls []string
+		for _, u := range tier{
+			if u != ""{
+				urls = append(urls, u)
+			}
+		}
+		if len(urls) > 0{
+			ret = append(ret, urls)
+		}
+	}
+	return ret
+}
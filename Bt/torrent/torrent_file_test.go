@@ -0,0 +1,73 @@
+package torrent
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+
+)
+
+func TestParseFile(t *testing.T) {
+	file, err := os.Open("../testfile/debian-iso.torrent")
+	assert.Equal(t, nil, err)
+	defer file.Close()
+	tf, err := ParseFile(bufio.NewReader(file))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "http://bttracker.debian.org:6969/announce", tf.Announce)
+	assert.Equal(t, "debian-11.2.0-amd64-netinst.iso", tf.FileName)
+	assert.Equal(t, 396361728, tf.FileLen)
+	assert.Equal(t, 262144, tf.PieceLen)
+	assert.Equal(t, 1512, len(tf.PieceSHA))
+	assert.Equal(t, 1512, tf.PieceCount())
+	assert.False(t, tf.Private)
+	assert.Equal(t, [][]string{{"http://bttracker.debian.org:6969/announce"}}, tf.Tiers())
+	assert.Equal(t, 2, len(tf.HTTPSeeds))
+	var expectHASH = [20]byte{0x28, 0xc5, 0x51, 0x96, 0xf5, 0x77, 0x53, 0xc4, 0xa,
+		0xce, 0xb6, 0xfb, 0x58, 0x61, 0x7e, 0x69, 0x95, 0xa7, 0xed, 0xdb}
+	assert.Equal(t, expectHASH, tf.InfoSHA)
+}
+
+func TestParseFileRawInfo(t *testing.T) {
+	//info中有rawInfo不认识的key，且key没有按字典序排列
+	info := "d4:name3:abc6:lengthi5e7:privatei1e12:piece lengthi16384e6:pieces20:aaaaaaaaaaaaaaaaaaaae"
+	in := "d8:announce9:http://a/4:info" + info + "e"
+	tf, err := ParseFile(bytes.NewBufferString(in))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, sha1.Sum([]byte(info)), tf.InfoSHA)
+	assert.Equal(t, "abc", tf.FileName)
+	assert.Equal(t, 5, tf.FileLen)
+	assert.Equal(t, 1, len(tf.PieceSHA))
+	assert.True(t, tf.Private)
+}
+
+func TestParseFileMultiFile(t *testing.T) {
+	info := "d5:filesld6:lengthi3e4:pathl1:a5:b.txteed6:lengthi0e4:pathl5:emptyeed6:lengthi7e4:pathl1:ceee" +
+		"4:name4:root12:piece lengthi4e6:pieces60:" + strings.Repeat("x", 60) + "e"
+	in := "d8:announce9:http://a/4:info" + info + "e"
+	tf, err := ParseFile(bytes.NewBufferString(in))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "root", tf.FileName)
+	assert.Equal(t, 10, tf.FileLen)
+	assert.Equal(t, []FileInfo{
+		{Path: []string{"a", "b.txt"}, Length: 3, Offset: 0},
+		{Path: []string{"empty"}, Length: 0, Offset: 3},
+		{Path: []string{"c"}, Length: 7, Offset: 3},
+	}, tf.Files)
+
+	in = "d4:infod5:filesld6:lengthi3e4:pathleee4:name1:a12:piece lengthi4e6:pieces0:ee"
+	_, err = ParseFile(bytes.NewBufferString(in))
+	assert.NotEqual(t, nil, err)
+}
+
+func TestParseFileAnnounceList(t *testing.T) {
+	info := "d6:lengthi5e4:name3:abc12:piece lengthi16384e6:pieces20:aaaaaaaaaaaaaaaaaaaae"
+	in := "d8:announce9:http://a/13:announce-listll9:http://a/9:http://b/el0:el9:http://c/0:ee4:info" + info + "e"
+	tf, err := ParseFile(bytes.NewBufferString(in))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, [][]string{{"http://a/", "http://b/"}, {"http://c/"}}, tf.AnnounceList)
+	assert.Equal(t, tf.AnnounceList, tf.Tiers())
+}
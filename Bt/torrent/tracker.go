@@ -1,10 +1,11 @@
 package torrent
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"go_code/Bt/bencode"
-
+	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
@@ -23,20 +24,88 @@ const(
 
 const IDLEN int = 20
 
+//tracker的响应来自网络，不可信，解码时限制资源
+var trackerDecodeOpts = bencode.DecoderOptions{
+	MaxDepth:		8,
+	MaxStringLen:	1 << 20,
+	MaxBytes:		4 << 20,
+	MaxEntries:		4096,
+}
+
 type PeerInfo struct {
 	Ip		net.IP
 	Port	uint16
 }
+
+//tracker返回的peer列表，可以直接从bencode解码
+type PeerList []PeerInfo
+
 //tracker的响应
 type TrackerResp struct {
-	Interval	int		`bencode:"interval"`	//间隔
-	Peers		string	`bencode:"peers"`
+	FailureReason	string		`bencode:"failure reason,omitempty"`	//请求失败时tracker给出的原因
+	Interval		int			`bencode:"interval"`	//间隔
+	Peers			PeerList	`bencode:"peers"`
+}
+
+//非紧凑格式中的一个peer
+type rawPeer struct {
+	Ip		string	`bencode:"ip"`
+	Port	uint16	`bencode:"port"`
+}
+
+//peers有两种格式：紧凑格式是一个string，每6byte一个peer；非紧凑格式是由dict组成的list
+func (peers *PeerList) UnmarshalBencode(data []byte) error{
+	obj, err := bencode.Parse(bytes.NewReader(data))
+	if err != nil{
+		return err
+	}
+	if str, err := obj.Str(); err == nil{
+		if len(str) % PeerLen != 0{
+			return fmt.Errorf("malformed compact peers, length %d", len(str))
+		}
+		*peers = buildPeerInfo([]byte(str))
+		return nil
+	}
+
+	var raws []rawPeer
+	err = bencode.Unmarshal(bytes.NewReader(data), &raws)
+	if err != nil{
+		return err
+	}
+	infos := make(PeerList, 0, len(raws))
+	for _, raw := range raws{
+		ip := net.ParseIP(raw.Ip)
+		if ip == nil{
+			continue
+		}
+		infos = append(infos, PeerInfo{Ip: ip, Port: raw.Port})
+	}
+	*peers = infos
+	return nil
+}
+
+//按紧凑格式编码，只包含IPv4的peer
+func (peers PeerList) MarshalBencode() ([]byte, error){
+	compact := make([]byte, 0, len(peers) * PeerLen)
+	for _, peer := range peers{
+		ip := peer.Ip.To4()
+		if ip == nil{
+			continue
+		}
+		port := make([]byte, PortLen)
+		binary.BigEndian.PutUint16(port, peer.Port)
+		compact = append(compact, ip...)
+		compact = append(compact, port...)
+	}
+	buf := new(bytes.Buffer)
+	_, err := bencode.EncodeString(buf, string(compact))
+	return buf.Bytes(), err
 }
 //构造url
-func buildUrl(tf *TorrentFile, peerId [IDLEN]byte)(string, error){
-	base, err := url.Parse(tf.Announce)
+func buildUrl(tf *TorrentFile, announce string, peerId [IDLEN]byte)(string, error){
+	base, err := url.Parse(announce)
 	if err != nil{
-		fmt.Println("Announce Error: " + tf.Announce)
+		fmt.Println("Announce Error: " + announce)
 		return "", err
 	}
 
@@ -72,30 +141,98 @@ func buildPeerInfo(peers []byte) []PeerInfo{
 }
 
 
-func FindPeers(tf *TorrentFile, peerId [IDLEN]byte) []PeerInfo{
+//向一个tracker请求peer
+func announce(tf *TorrentFile, announce string, peerId [IDLEN]byte) (*TrackerResp, error){
 	//拿到请求
-	url, err := buildUrl(tf, peerId)
+	url, err := buildUrl(tf, announce, peerId)
 	if err != nil{
-		fmt.Println("Build Tracker Url Error: " + err.Error())
-		return nil
+		return nil, err
 	}
 
 	//发送http的get请求
 	cli := &http.Client{Timeout: 15 * time.Second}
 	resp, err := cli.Get(url)	//resp也是一个bencode编码，所以需要先反序列化
 	if err != nil{
-		fmt.Println("Fail to Connect to Tracker: " + err.Error())
-		return nil
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	//
 	trackResp := new(TrackerResp)
-	err = bencode.Unmarshal(resp.Body, trackResp)
+	err = trackerDecodeOpts.Unmarshal(resp.Body, trackResp)
 	if err != nil{
-		fmt.Println("Tracker Response Error" + err.Error())
-		return nil
+		return nil, err
+	}
+	if trackResp.FailureReason != ""{
+		return nil, fmt.Errorf("tracker failure: %s", trackResp.FailureReason)
+	}
+	return trackResp, nil
+}
+
+/*
+	分层的tracker列表(BEP 12)：
+		1. 每一层内的tracker先随机打乱
+		2. 每一层按顺序尝试，直到有一个tracker响应，响应的tracker移到该层的最前面，下次优先使用
+		3. 所有层都会请求，各层得到的peer合并去重
+	每一层只使用第一个响应的tracker，同一层中排在它后面的tracker不会请求
+*/
+type TrackerList struct {
+	tiers	[][]string
+}
+
+//按tf的announce-list创建，没有announce-list时只有announce一个tracker
+func NewTrackerList(tf *TorrentFile) *TrackerList{
+	tiers := tf.Tiers()
+	tl := &TrackerList{tiers: make([][]string, len(tiers))}
+	for i, tier := range tiers{
+		urls := append([]string(nil), tier...)
+		rand.Shuffle(len(urls), func(i, j int){
+			urls[i], urls[j] = urls[j], urls[i]
+		})
+		tl.tiers[i] = urls
 	}
+	return tl
+}
+
+//当前的tracker顺序
+func (tl *TrackerList) Tiers() [][]string{
+	ret := make([][]string, len(tl.tiers))
+	for i, tier := range tl.tiers{
+		ret[i] = append([]string(nil), tier...)
+	}
+	return ret
+}
+
+//向每一层中第一个响应的tracker请求peer，返回合并去重后的peer；不能并发调用
+func (tl *TrackerList) FindPeers(tf *TorrentFile, peerId [IDLEN]byte) []PeerInfo{
+	var peers []PeerInfo
+	seen := make(map[string]bool)
+	for _, tier := range tl.tiers{
+		for i, u := range tier{
+			resp, err := announce(tf, u, peerId)
+			if err != nil{
+				fmt.Println("Fail to Announce to Tracker " + u + ": " + err.Error())
+				continue
+			}
+			//把响应的tracker移到该层的最前面
+			copy(tier[1 : i + 1], tier[:i])
+			tier[0] = u
+			for _, peer := range resp.Peers{
+				key := peerKey(peer)
+				if !seen[key]{
+					seen[key] = true
+					peers = append(peers, peer)
+				}
+			}
+			break
+		}
+	}
+	return peers
+}
 
-	return buildPeerInfo([]byte(trackResp.Peers))
-}
\ No newline at end of file
+//向tf中的tracker请求peer，TrackerList保存在tf中，再次请求时沿用上次的顺序
+func FindPeers(tf *TorrentFile, peerId [IDLEN]byte) []PeerInfo{
+	if tf.trackers == nil{
+		tf.trackers = NewTrackerList(tf)
+	}
+	return tf.trackers.FindPeers(tf, peerId)
+}
@@ -0,0 +1,102 @@
+package torrent
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"go_code/Bt/bencode"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+)
+
+func TestTrackerRespCompact(t *testing.T) {
+	in := "d8:intervali900e5:peers12:\x7f\x00\x00\x01\x1a\x0a\x0a\x00\x00\x02\x00\x50e"
+	resp := new(TrackerResp)
+	err := bencode.Unmarshal(bytes.NewBufferString(in), resp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 900, resp.Interval)
+	assert.Equal(t, 2, len(resp.Peers))
+	assert.True(t, net.IPv4(127, 0, 0, 1).Equal(resp.Peers[0].Ip))
+	assert.Equal(t, uint16(6666), resp.Peers[0].Port)
+	assert.True(t, net.IPv4(10, 0, 0, 2).Equal(resp.Peers[1].Ip))
+	assert.Equal(t, uint16(80), resp.Peers[1].Port)
+
+	out := new(bytes.Buffer)
+	bencode.Marshal(out, resp)
+	assert.Equal(t, in, out.String())
+
+	err = bencode.Unmarshal(bytes.NewBufferString("d5:peers5:abcdee"), resp)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestTrackerRespDict(t *testing.T) {
+	in := "d8:intervali60e5:peersld2:ip9:127.0.0.17:peer id20:aaaaaaaaaaaaaaaaaaaa4:porti6881eeee"
+	resp := new(TrackerResp)
+	err := bencode.Unmarshal(bytes.NewBufferString(in), resp)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(resp.Peers))
+	assert.True(t, net.IPv4(127, 0, 0, 1).Equal(resp.Peers[0].Ip))
+	assert.Equal(t, uint16(6881), resp.Peers[0].Port)
+}
+
+//返回固定响应的tracker
+func newTracker(t *testing.T, resp string, hits *int) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*hits++
+		w.Write([]byte(resp))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestTrackerListFailover(t *testing.T) {
+	var hitsA, hitsB, hitsC, hitsD int
+	//a挂掉，b、c在同一层；d在第二层，和c返回一个相同的peer
+	a := newTracker(t, "", &hitsA)
+	a.Close()
+	b := newTracker(t, "d14:failure reason4:busye", &hitsB)
+	c := newTracker(t, "d8:intervali900e5:peers12:\x7f\x00\x00\x01\x1a\x0a\x0a\x00\x00\x02\x00\x50e", &hitsC)
+	d := newTracker(t, "d8:intervali900e5:peers12:\x7f\x00\x00\x01\x1a\x0a\x0a\x00\x00\x03\x00\x50e", &hitsD)
+
+	tf := &TorrentFile{
+		Announce:     a.URL,
+		AnnounceList: [][]string{{a.URL, b.URL, c.URL}, {d.URL}},
+	}
+	tl := NewTrackerList(tf)
+	assert.ElementsMatch(t, []string{a.URL, b.URL, c.URL}, tl.Tiers()[0])
+
+	var peerId [IDLEN]byte
+	peers := tl.FindPeers(tf, peerId)
+	assert.Equal(t, 3, len(peers))
+	assert.Equal(t, []string{c.URL}, tl.Tiers()[0][:1])
+	assert.Equal(t, 1, hitsC)
+	assert.Equal(t, 1, hitsD)
+
+	//c已经提到了最前面，下次不再尝试a和b
+	hitsB = 0
+	tl.FindPeers(tf, peerId)
+	assert.Equal(t, 0, hitsB)
+	assert.Equal(t, 2, hitsC)
+}
+
+func TestFindPeersKeepsOrder(t *testing.T) {
+	var hitsA, hitsB int
+	//a返回失败，b响应后被提到最前面，tf中保存的顺序在下次请求时继续使用
+	a := newTracker(t, "d14:failure reason4:busye", &hitsA)
+	b := newTracker(t, "d8:intervali900e5:peers6:\x7f\x00\x00\x01\x1a\x0ae", &hitsB)
+	tf := &TorrentFile{AnnounceList: [][]string{{a.URL, b.URL}}}
+
+	var peerId [IDLEN]byte
+	assert.Equal(t, 1, len(FindPeers(tf, peerId)))
+	hitsA = 0
+	assert.Equal(t, 1, len(FindPeers(tf, peerId)))
+	assert.Equal(t, 0, hitsA)
+	assert.Equal(t, 2, hitsB)
+}
+
+func TestTrackerListAnnounceOnly(t *testing.T) {
+	tl := NewTrackerList(&TorrentFile{Announce: "http://a/announce"})
+	assert.Equal(t, [][]string{{"http://a/announce"}}, tl.Tiers())
+}
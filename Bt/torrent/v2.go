@@ -0,0 +1,237 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"go_code/Bt/bencode"
+	"sort"
+
+)
+
+/*
+	BitTorrent v2(BEP 52)：
+		1. info hash是info的SHA-256，握手和tracker中使用前20byte
+		2. 文件由file tree描述，每个文件单独切分piece，文件的起始位置对齐到piece长度
+		3. 文件按16KB分块，每块的SHA-256作为叶子构成merkle树，pieces root是树根
+		4. 超过一个piece的文件，piece layers中保存每个piece对应的树节点，用来校验单个piece
+	hybrid种子同时包含v1的pieces、files(用填充文件对齐piece)和v2的数据，v1和v2的文件必须一致
+*/
+
+const SHA256LEN int = 32
+
+//file tree中文件的数据
+type v2FileAttr struct {
+	Length		int		`bencode:"length"`
+	PiecesRoot	string	`bencode:"pieces root,omitempty"`	//空文件没有pieces root
+}
+
+//file tree中的一个文件
+type v2File struct {
+	Path	[]string
+	v2FileAttr
+}
+
+//file tree：目录是以名字为key的dict，文件是只有一个空key的dict，空key对应文件的数据
+//按key的顺序展开成文件列表
+type fileTree []v2File
+
+func (tree *fileTree) UnmarshalBencode(data []byte) error{
+	var files fileTree
+	err := walkFileTree(data, nil, &files)
+	if err != nil{
+		return err
+	}
+	*tree = files
+	return nil
+}
+
+func walkFileTree(data []byte, path []string, files *fileTree) error{
+	var node map[string]bencode.RawMessage
+	err := bencode.UnmarshalBytes(data, &node)
+	if err != nil{
+		return err
+	}
+	if attr, ok := node[""]; ok{
+		if len(path) == 0 || len(node) != 1{
+			return fmt.Errorf("malformed file tree node %q", path)
+		}
+		f := v2File{Path: append([]string(nil), path...)}
+		err := bencode.UnmarshalBytes(attr, &f.v2FileAttr)
+		if err != nil{
+			return err
+		}
+		*files = append(*files, f)
+		return nil
+	}
+	if len(node) == 0{
+		return fmt.Errorf("empty directory %q in file tree", path)
+	}
+	names := make([]string, 0, len(node))
+	for name := range node{
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names{
+		err := walkFileTree(node[name], append(path, name), files)
+		if err != nil{
+			return err
+		}
+	}
+	return nil
+}
+
+func (tree fileTree) MarshalBencode() ([]byte, error){
+	root := make(map[string]interface{})
+	for _, f := range tree{
+		if len(f.Path) == 0{
+			return nil, fmt.Errorf("file tree entry has empty path")
+		}
+		dir := root
+		for _, name := range f.Path[:len(f.Path) - 1]{
+			sub, ok := dir[name].(map[string]interface{})
+			if !ok{
+				sub = make(map[string]interface{})
+				dir[name] = sub
+			}
+			dir = sub
+		}
+		dir[f.Path[len(f.Path) - 1]] = map[string]interface{}{"": f.v2FileAttr}
+	}
+	buf := new(bytes.Buffer)
+	_, err := bencode.Marshal(buf, root)
+	return buf.Bytes(), err
+}
+
+//merkle树的叶子数必须是2的幂
+func nextPow2(n int) int{
+	p := 1
+	for p < n{
+		p *= 2
+	}
+	return p
+}
+
+//每16KB一块，计算每块的SHA-256
+func blockHashes(data []byte) [][SHA256LEN]byte{
+	hashes := make([][SHA256LEN]byte, 0, (len(data) + BLOCKSIZE - 1) / BLOCKSIZE)
+	for begin := 0; begin < len(data); begin += BLOCKSIZE{
+		end := begin + BLOCKSIZE
+		if end > len(data){
+			end = len(data)
+		}
+		hashes = append(hashes, sha256.Sum256(data[begin:end]))
+	}
+	return hashes
+}
+
+//以hashes为叶子，不足leaves个时用pad补齐，计算merkle树的根
+//补齐的部分不实际展开：每一层末尾缺的节点都是全由pad构成的子树的根，逐层计算即可，内存只和len(hashes)有关
+func merkleRoot(hashes [][SHA256LEN]byte, leaves int, pad [SHA256LEN]byte) [SHA256LEN]byte{
+	layer := append([][SHA256LEN]byte(nil), hashes...)
+	buf := make([]byte, 2 * SHA256LEN)
+	hash := func(a, b [SHA256LEN]byte) [SHA256LEN]byte{
+		copy(buf, a[:])
+		copy(buf[SHA256LEN:], b[:])
+		return sha256.Sum256(buf)
+	}
+	for ; leaves > 1; leaves /= 2{
+		if len(layer) % 2 == 1{
+			layer = append(layer, pad)
+		}
+		next := layer[:len(layer) / 2]
+		for i := range next{
+			next[i] = hash(layer[2 * i], layer[2 * i + 1])
+		}
+		layer = next
+		pad = hash(pad, pad)
+	}
+	if len(layer) == 0{
+		return pad
+	}
+	return layer[0]
+}
+
+//piece layer中补齐用的节点：一个piece的叶子全为0时的根，即全0的节点逐层hash log2(叶子数)次
+func padPieceHash(pieceLen int) [SHA256LEN]byte{
+	return merkleRoot(nil, pieceLen / BLOCKSIZE, [SHA256LEN]byte{})
+}
+
+//由file tree和piece layers生成文件列表，每个文件的起始位置对齐到piece长度，返回文件的实际总长度
+func buildV2Files(tree fileTree, layers map[string]string, pieceLen int) ([]FileInfo, int, error){
+	if pieceLen < BLOCKSIZE || pieceLen > maxPieceLenLimit || pieceLen != nextPow2(pieceLen){
+		return nil, 0, fmt.Errorf("v2 piece length %d is not a power of 2 between %d and %d", pieceLen, BLOCKSIZE, maxPieceLenLimit)
+	}
+	if len(tree) == 0{
+		return nil, 0, fmt.Errorf("empty file tree")
+	}
+	pad := padPieceHash(pieceLen)
+	files := make([]FileInfo, len(tree))
+	offset, total := 0, 0
+	for i, f := range tree{
+		if f.Length < 0{
+			return nil, 0, fmt.Errorf("file %q has negative length %d", f.Path, f.Length)
+		}
+		info := FileInfo{Path: f.Path, Length: f.Length, Offset: offset}
+		if f.Length > 0{
+			if len(f.PiecesRoot) != SHA256LEN{
+				return nil, 0, fmt.Errorf("file %q has malformed pieces root", f.Path)
+			}
+			copy(info.PiecesRoot[:], f.PiecesRoot)
+		}
+		//超过一个piece的文件需要piece layer，所有节点构成的树的根必须是pieces root
+		cnt := (f.Length + pieceLen - 1) / pieceLen
+		if cnt > 1{
+			layer, ok := layers[f.PiecesRoot]
+			if !ok{
+				return nil, 0, fmt.Errorf("file %q has no piece layer", f.Path)
+			}
+			if len(layer) != cnt * SHA256LEN{
+				return nil, 0, fmt.Errorf("file %q has piece layer of length %d, expect %d", f.Path, len(layer), cnt * SHA256LEN)
+			}
+			info.PieceLayer = make([][SHA256LEN]byte, cnt)
+			for j := range info.PieceLayer{
+				copy(info.PieceLayer[j][:], layer[j * SHA256LEN:])
+			}
+			if merkleRoot(info.PieceLayer, nextPow2(cnt), pad) != info.PiecesRoot{
+				return nil, 0, fmt.Errorf("piece layer of file %q does not match pieces root", f.Path)
+			}
+		}
+		files[i] = info
+		offset += cnt * pieceLen
+		total += f.Length
+	}
+	return files, total, nil
+}
+
+//hybrid种子中v1的文件(跳过填充文件)必须和v2的文件一一对应，对应的v1文件带上v2的校验数据
+func mergeHybridFiles(v1 []FileInfo, v2 []FileInfo) error{
+	j := 0
+	for i := range v1{
+		if v1[i].Padding{
+			continue
+		}
+		if j >= len(v2) || !equalPath(v1[i].Path, v2[j].Path) || v1[i].Length != v2[j].Length{
+			return fmt.Errorf("hybrid torrent has inconsistent v1 and v2 files")
+		}
+		v1[i].PiecesRoot = v2[j].PiecesRoot
+		v1[i].PieceLayer = v2[j].PieceLayer
+		j++
+	}
+	if j != len(v2){
+		return fmt.Errorf("hybrid torrent has inconsistent v1 and v2 files")
+	}
+	return nil
+}
+
+func equalPath(a, b []string) bool{
+	if len(a) != len(b){
+		return false
+	}
+	for i := range a{
+		if a[i] != b[i]{
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,219 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"github.com/stretchr/testify/assert"
+	"go_code/Bt/bencode"
+	"os"
+	"path/filepath"
+	"testing"
+
+)
+
+func TestMerkleRoot(t *testing.T) {
+	a := bytes.Repeat([]byte("a"), BLOCKSIZE)
+	b := []byte("b")
+	ha, hb := sha256.Sum256(a), sha256.Sum256(b)
+	assert.Equal(t, ha, merkleRoot(blockHashes(a), 1, [SHA256LEN]byte{}))
+	data := append(append([]byte{}, a...), b...)
+	assert.Equal(t, sha256.Sum256(append(ha[:], hb[:]...)), merkleRoot(blockHashes(data), 2, [SHA256LEN]byte{}))
+	//叶子不足时补0
+	var zero [SHA256LEN]byte
+	left := sha256.Sum256(append(ha[:], hb[:]...))
+	right := sha256.Sum256(append(zero[:], zero[:]...))
+	assert.Equal(t, sha256.Sum256(append(left[:], right[:]...)), merkleRoot(blockHashes(data), 4, zero))
+
+	//不展开补齐的叶子，结果和显式补齐后相同
+	pad := sha256.Sum256([]byte("pad"))
+	hashes := [][SHA256LEN]byte{ha, hb, left}
+	full := append(append([][SHA256LEN]byte{}, hashes...), pad, pad, pad, pad, pad)
+	assert.Equal(t, merkleRoot(full, 8, pad), merkleRoot(hashes, 8, pad))
+	assert.Equal(t, merkleRoot(make([][SHA256LEN]byte, 64), 64, zero), padPieceHash(64 * BLOCKSIZE))
+	assert.Equal(t, hashes, [][SHA256LEN]byte{ha, hb, left})
+}
+
+const v2PieceLen = 2 * BLOCKSIZE
+
+//一个v2文件的pieces root和piece layer
+func v2Hashes(data []byte) ([SHA256LEN]byte, []byte) {
+	if len(data) <= v2PieceLen {
+		return merkleRoot(blockHashes(data), nextPow2((len(data) + BLOCKSIZE - 1) / BLOCKSIZE), [SHA256LEN]byte{}), nil
+	}
+	var nodes [][SHA256LEN]byte
+	var layer []byte
+	for begin := 0; begin < len(data); begin += v2PieceLen {
+		end := begin + v2PieceLen
+		if end > len(data) {
+			end = len(data)
+		}
+		node := merkleRoot(blockHashes(data[begin:end]), v2PieceLen / BLOCKSIZE, [SHA256LEN]byte{})
+		nodes = append(nodes, node)
+		layer = append(layer, node[:]...)
+	}
+	return merkleRoot(nodes, nextPow2(len(nodes)), padPieceHash(v2PieceLen)), layer
+}
+
+//big跨越3个piece，small和empty不超过一个piece
+var (
+	v2Big   = bytes.Repeat([]byte("0123456789"), 8 * 1024)
+	v2Small = []byte("small file")
+)
+
+func v2Tree() (fileTree, map[string]string) {
+	bigRoot, bigLayer := v2Hashes(v2Big)
+	smallRoot, _ := v2Hashes(v2Small)
+	tree := fileTree{
+		{Path: []string{"dir", "big"}, v2FileAttr: v2FileAttr{Length: len(v2Big), PiecesRoot: string(bigRoot[:])}},
+		{Path: []string{"empty"}, v2FileAttr: v2FileAttr{Length: 0}},
+		{Path: []string{"small"}, v2FileAttr: v2FileAttr{Length: len(v2Small), PiecesRoot: string(smallRoot[:])}},
+	}
+	return tree, map[string]string{string(bigRoot[:]): string(bigLayer)}
+}
+
+func encodeTorrent(t *testing.T, info *rawInfo, layers map[string]string) []byte {
+	buf := new(bytes.Buffer)
+	_, err := bencode.Marshal(buf, info)
+	assert.Equal(t, nil, err)
+	out := new(bytes.Buffer)
+	_, err = bencode.Marshal(out, &rawFile{Announce: "http://a/", Info: buf.Bytes(), PieceLayers: layers})
+	assert.Equal(t, nil, err)
+	return out.Bytes()
+}
+
+func TestParseV2(t *testing.T) {
+	tree, layers := v2Tree()
+	info := &rawInfo{Name: "v2", PieceLength: v2PieceLen, MetaVersion: 2, FileTree: tree}
+	data := encodeTorrent(t, info, layers)
+	tf, err := ParseFile(bytes.NewReader(data))
+	assert.Equal(t, nil, err)
+	assert.False(t, tf.HasV1())
+	assert.True(t, tf.HasV2())
+
+	//info hash是SHA-256，握手时截断为20byte
+	raw := new(rawFile)
+	assert.Equal(t, nil, bencode.UnmarshalBytes(data, raw))
+	assert.Equal(t, sha256.Sum256(raw.Info), tf.InfoSHA256)
+	assert.Equal(t, tf.InfoSHA256[:SHALEN], tf.InfoSHA[:])
+
+	assert.Equal(t, len(v2Big) + len(v2Small), tf.FileLen)
+	assert.Equal(t, 3, len(tf.Files))
+	assert.Equal(t, []string{"dir", "big"}, tf.Files[0].Path)
+	assert.Equal(t, 3, len(tf.Files[0].PieceLayer))
+	//文件的起始位置对齐到piece长度
+	assert.Equal(t, 0, tf.Files[0].Offset)
+	assert.Equal(t, 3 * v2PieceLen, tf.Files[1].Offset)
+	assert.Equal(t, 3 * v2PieceLen, tf.Files[2].Offset)
+	assert.Equal(t, 4, tf.PieceCount())
+
+	task := &TorrentTask{FileName: filepath.Join(t.TempDir(), "v2"), FileLen: tf.FileLen, Files: tf.Files, PieceLen: tf.PieceLen, V2: true}
+	pieces := task.pieceTasks()
+	assert.Equal(t, 4, len(pieces))
+	contents := [][]byte{v2Big[:v2PieceLen], v2Big[v2PieceLen : 2 * v2PieceLen], v2Big[2 * v2PieceLen:], v2Small}
+	store, err := openStorage(task)
+	assert.Equal(t, nil, err)
+	for i, piece := range pieces {
+		assert.Equal(t, i, piece.index)
+		assert.Equal(t, len(contents[i]), piece.length)
+		assert.True(t, checkPiece(piece, &pieceResult{i, contents[i]}))
+		bad := append([]byte{}, contents[i]...)
+		bad[0]++
+		assert.False(t, checkPiece(piece, &pieceResult{i, bad}))
+		assert.Equal(t, nil, store.WriteAt(contents[i], piece.begin))
+	}
+	assert.Equal(t, nil, store.Close())
+	got, err := os.ReadFile(filepath.Join(task.FileName, "dir", "big"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, v2Big, got)
+	got, err = os.ReadFile(filepath.Join(task.FileName, "small"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, v2Small, got)
+
+	//piece layer和pieces root不一致
+	for k, v := range layers {
+		layers[k] = v[:len(v) - 1] + "x"
+	}
+	_, err = ParseFile(bytes.NewReader(encodeTorrent(t, info, layers)))
+	assert.NotEqual(t, nil, err)
+	_, err = ParseFile(bytes.NewReader(encodeTorrent(t, info, nil)))
+	assert.NotEqual(t, nil, err)
+}
+
+func TestParseHybrid(t *testing.T) {
+	tree, layers := v2Tree()
+	//v1的文件用填充文件对齐到piece长度
+	pad := 3 * v2PieceLen - len(v2Big)
+	all := append(append(append([]byte{}, v2Big...), make([]byte, pad)...), v2Small...)
+	var pieces PieceHashes
+	for begin := 0; begin < len(all); begin += v2PieceLen {
+		end := begin + v2PieceLen
+		if end > len(all) {
+			end = len(all)
+		}
+		pieces = append(pieces, sha1.Sum(all[begin:end]))
+	}
+	info := &rawInfo{
+		Name:        "hybrid",
+		PieceLength: v2PieceLen,
+		MetaVersion: 2,
+		FileTree:    tree,
+		Pieces:      pieces,
+		Files: []rawFileEntry{
+			{Length: len(v2Big), Path: []string{"dir", "big"}},
+			{Attr: "p", Length: pad, Path: []string{".pad", "1"}},
+			{Length: 0, Path: []string{"empty"}},
+			{Length: len(v2Small), Path: []string{"small"}},
+		},
+	}
+	data := encodeTorrent(t, info, layers)
+	tf, err := ParseFile(bytes.NewReader(data))
+	assert.Equal(t, nil, err)
+	assert.True(t, tf.HasV1())
+	assert.True(t, tf.HasV2())
+	raw := new(rawFile)
+	assert.Equal(t, nil, bencode.UnmarshalBytes(data, raw))
+	assert.Equal(t, sha1.Sum(raw.Info), tf.InfoSHA)
+	assert.Equal(t, len(all), tf.FileLen)
+	assert.True(t, tf.Files[1].Padding)
+	assert.Equal(t, 3, len(tf.Files[0].PieceLayer))
+	assert.NotEqual(t, [SHA256LEN]byte{}, tf.Files[3].PiecesRoot)
+
+	//按v1下载时不创建填充文件
+	task := &TorrentTask{FileName: filepath.Join(t.TempDir(), "hybrid"), FileLen: tf.FileLen, Files: tf.Files, PieceLen: tf.PieceLen, PieceSHA: tf.PieceSHA}
+	store, err := openStorage(task)
+	assert.Equal(t, nil, err)
+	for _, piece := range task.pieceTasks() {
+		res := &pieceResult{piece.index, all[piece.begin : piece.begin + piece.length]}
+		assert.True(t, checkPiece(piece, res))
+		assert.Equal(t, nil, store.WriteAt(res.data, piece.begin))
+	}
+	assert.Equal(t, nil, store.Close())
+	_, err = os.Stat(filepath.Join(task.FileName, ".pad"))
+	assert.True(t, os.IsNotExist(err))
+	got, err := os.ReadFile(filepath.Join(task.FileName, "small"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, v2Small, got)
+
+	//v1和v2的文件不一致
+	info.Files[3].Length--
+	_, err = ParseFile(bytes.NewReader(encodeTorrent(t, info, layers)))
+	assert.NotEqual(t, nil, err)
+}
+
+func TestParseV2HugePieceLength(t *testing.T) {
+	//很小的种子声明了2^50的piece长度，不能按piece长度分配内存
+	tree, _ := v2Tree()
+	info := &rawInfo{Name: "v2", PieceLength: 1 << 50, MetaVersion: 2, FileTree: tree[2:]}
+	_, err := ParseFile(bytes.NewReader(encodeTorrent(t, info, nil)))
+	assert.NotEqual(t, nil, err)
+
+	info.PieceLength = maxPieceLenLimit * 2
+	_, err = ParseFile(bytes.NewReader(encodeTorrent(t, info, nil)))
+	assert.NotEqual(t, nil, err)
+	_, _, err = buildV2Files(tree[2:], nil, maxPieceLenLimit)
+	assert.Equal(t, nil, err)
+
+	tf := &TorrentFile{FileName: "a", FileLen: 1, PieceLen: 1 << 50, PieceSHA: make([][SHALEN]byte, 1)}
+	assert.NotEqual(t, nil, tf.Validate())
+}
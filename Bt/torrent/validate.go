@@ -0,0 +1,145 @@
+package torrent
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+)
+
+/*
+	种子来自不可信的来源，使用之前需要检查：
+		1. piece长度为正且不超过maxPieceLenLimit，v1的piece个数和文件总长度一致
+		2. name和文件路径中的每一级都只能是单独的名字：不能为空、不能是.和..、不能包含路径分隔符和NUL
+	写入本地时再对每一级名字做清理，保证文件不会写到下载目录之外，并且在常见的文件系统上都能创建
+*/
+
+//解析种子时允许的最大piece长度，下载时每个piece都要整个放在内存中
+const maxPieceLenLimit = 256 << 20
+
+//一级文件名的最大长度(byte)，大部分文件系统的限制
+const maxNameLen = 255
+
+//截断文件名时保留的扩展名的最大长度
+const maxExtLen = 16
+
+//Windows上保留的设备名，不区分大小写，带扩展名也不行
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+//检查种子的内容，ParseFile和FetchMetadata得到的TorrentFile都已经检查过
+func (tf *TorrentFile) Validate() error{
+	if tf.PieceLen <= 0 || tf.PieceLen > maxPieceLenLimit{
+		return fmt.Errorf("invalid piece length %d", tf.PieceLen)
+	}
+	if tf.FileLen < 0{
+		return fmt.Errorf("invalid length %d", tf.FileLen)
+	}
+	if tf.HasV1(){
+		expect := (tf.FileLen + tf.PieceLen - 1) / tf.PieceLen
+		if len(tf.PieceSHA) != expect{
+			return fmt.Errorf("torrent has %d pieces, expect %d for length %d and piece length %d", len(tf.PieceSHA), expect, tf.FileLen, tf.PieceLen)
+		}
+	}
+	if err := checkName(tf.FileName); err != nil{
+		return fmt.Errorf("invalid name: %w", err)
+	}
+
+	//清理后的路径不能重复，否则多个文件会写到同一个本地文件；填充文件不写到本地，可以重名
+	seen := make(map[string]bool)
+	for i, f := range tf.Files{
+		if len(f.Path) == 0{
+			return fmt.Errorf("file %d has empty path", i)
+		}
+		for _, name := range f.Path{
+			if err := checkName(name); err != nil{
+				return fmt.Errorf("invalid path of file %d: %w", i, err)
+			}
+		}
+		if f.Padding{
+			continue
+		}
+		path := sanitizePath(f.Path)
+		if seen[path]{
+			return fmt.Errorf("duplicate file path %q", strings.Join(f.Path, "/"))
+		}
+		seen[path] = true
+	}
+	return nil
+}
+
+//检查一级名字
+func checkName(name string) error{
+	switch {
+	case name == "":
+		return fmt.Errorf("empty name")
+	case name == "." || name == "..":
+		return fmt.Errorf("name %q is not allowed", name)
+	case strings.IndexByte(name, 0) >= 0:
+		return fmt.Errorf("name %q contains NUL", name)
+	case strings.ContainsAny(name, `/\`):
+		return fmt.Errorf("name %q contains a path separator", name)
+	}
+	return nil
+}
+
+/*
+	清理一级名字，使它可以作为本地的文件名：
+		1. 控制字符、不合法的UTF-8和Windows上不允许的字符替换为'_'
+		2. 超过maxNameLen的名字截断，尽量保留扩展名
+		3. 结尾的'.'和空格替换为'_'，Windows会去掉它们
+		4. 保留的设备名后面加上'_'
+	.和..也会被替换，结果中不会有路径分隔符
+*/
+func sanitizeName(name string) string{
+	if name == ""{
+		return "_"
+	}
+	var sb strings.Builder
+	for _, r := range name{
+		if r < 0x20 || r == 0x7f || r == utf8.RuneError || strings.ContainsRune(`/\:*?"<>|`, r){
+			sb.WriteByte('_')
+		}else{
+			sb.WriteRune(r)
+		}
+	}
+	name = sb.String()
+
+	if len(name) > maxNameLen{
+		ext := filepath.Ext(name)
+		if len(ext) > maxExtLen{
+			ext = ""
+		}
+		//在UTF-8字符的边界截断
+		n := maxNameLen - len(ext)
+		for n > 0 && !utf8.RuneStart(name[n]){
+			n--
+		}
+		name = name[:n] + ext
+	}
+
+	trimmed := strings.TrimRight(name, ". ")
+	name = trimmed + strings.Repeat("_", len(name) - len(trimmed))
+
+	stem := name
+	if i := strings.IndexByte(name, '.'); i >= 0{
+		stem = name[:i]
+	}
+	if reservedNames[strings.ToUpper(stem)]{
+		name = stem + "_" + name[len(stem):]
+	}
+	return name
+}
+
+//把种子中的路径转换为本地的相对路径
+func sanitizePath(path []string) string{
+	names := make([]string, len(path))
+	for i, name := range path{
+		names[i] = sanitizeName(name)
+	}
+	return filepath.Join(names...)
+}
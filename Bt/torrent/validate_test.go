@@ -0,0 +1,114 @@
+package torrent
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+)
+
+func TestValidate(t *testing.T) {
+	single := func(name string, length int, pieceLen int, pieces string) string {
+		return "d4:infod6:lengthi" + strconv.Itoa(length) + "e4:name" + strconv.Itoa(len(name)) + ":" + name +
+			"12:piece lengthi" + strconv.Itoa(pieceLen) + "e6:pieces" + strconv.Itoa(len(pieces)) + ":" + pieces + "ee"
+	}
+	_, err := ParseFile(bytes.NewBufferString(single("abc", 5, 4, strings.Repeat("x", 40))))
+	assert.Equal(t, nil, err)
+
+	bad := []string{
+		single("abc", 5, 4, strings.Repeat("x", 30)),	//pieces的长度不是20的倍数
+		single("abc", 5, 4, strings.Repeat("x", 20)),	//piece个数和长度不一致
+		single("abc", 5, 4, strings.Repeat("x", 60)),
+		single("abc", 5, 0, ""),
+		single("abc", -1, 4, ""),
+		single("", 5, 4, strings.Repeat("x", 40)),
+		single("..", 5, 4, strings.Repeat("x", 40)),
+		single("/etc/passwd", 5, 4, strings.Repeat("x", 40)),
+		single("a\\b", 5, 4, strings.Repeat("x", 40)),
+		single("a\x00b", 5, 4, strings.Repeat("x", 40)),
+		//v1的info中length和files有且只有一个
+		"d4:infod4:name1:a12:piece lengthi16384eee",
+		"d4:infod5:filesld6:lengthi1e4:pathl1:beee6:lengthi1e4:name1:a12:piece lengthi16384e6:pieces20:" + strings.Repeat("x", 20) + "ee",
+	}
+	for _, in := range bad {
+		_, err := ParseFile(bytes.NewBufferString(in))
+		assert.NotEqual(t, nil, err, in)
+	}
+
+	tf := &TorrentFile{FileName: "root", FileLen: 4, PieceLen: 4, PieceSHA: make([][SHALEN]byte, 1)}
+	for _, path := range [][]string{{"a", ".."}, {"..", "x"}, {"a", ""}, {"a/b"}, {}} {
+		tf.Files = []FileInfo{{Path: path, Length: 4}}
+		assert.NotEqual(t, nil, tf.Validate(), path)
+	}
+	//清理后重名
+	tf.Files = []FileInfo{{Path: []string{"a:b"}, Length: 2}, {Path: []string{"a?b"}, Length: 2, Offset: 2}}
+	assert.NotEqual(t, nil, tf.Validate())
+	//填充文件可以重名
+	tf.Files = []FileInfo{
+		{Path: []string{"a"}, Length: 1},
+		{Path: []string{".pad", "1"}, Length: 1, Offset: 1, Padding: true},
+		{Path: []string{"b"}, Length: 1, Offset: 2},
+		{Path: []string{".pad", "1"}, Length: 1, Offset: 3, Padding: true},
+	}
+	assert.Equal(t, nil, tf.Validate())
+}
+
+func TestSanitizeName(t *testing.T) {
+	cases := map[string]string{
+		"a.txt":      "a.txt",
+		"":           "_",
+		".":          "_",
+		"..":         "__",
+		"a:b*c?.txt": "a_b_c_.txt",
+		"tab\there":  "tab_here",
+		"bad\xffutf": "bad_utf",
+		"name. ":     "name__",
+		"CON":        "CON_",
+		"con.txt":    "con_.txt",
+		"Lpt1.tar.gz": "Lpt1_.tar.gz",
+		"CONSOLE":    "CONSOLE",
+		"中文名":        "中文名",
+	}
+	for in, expect := range cases {
+		assert.Equal(t, expect, sanitizeName(in), in)
+	}
+
+	//过长的名字截断时保留扩展名，并且不截断UTF-8字符
+	long := strings.Repeat("中", 100) + ".mkv"
+	got := sanitizeName(long)
+	assert.True(t, len(got) <= maxNameLen)
+	assert.True(t, strings.HasSuffix(got, ".mkv"))
+	assert.Equal(t, strings.Repeat("中", 83) + ".mkv", got)
+	got = sanitizeName(strings.Repeat("a", 300) + "." + strings.Repeat("b", 30))
+	assert.Equal(t, strings.Repeat("a", maxNameLen), got)
+}
+
+func TestStorageSanitize(t *testing.T) {
+	dir := t.TempDir()
+	task := &TorrentTask{
+		FileName: filepath.Join(dir, "root"),
+		FileLen:  2,
+		Files: []FileInfo{
+			{Path: []string{"..", "escape"}, Length: 1},
+			{Path: []string{"sub", "AUX"}, Length: 1, Offset: 1},
+		},
+		PieceLen: 2,
+	}
+	s, err := openStorage(task)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, s.WriteAt([]byte("ab"), 0))
+	assert.Equal(t, nil, s.Close())
+
+	_, err = os.Stat(filepath.Join(dir, "escape"))
+	assert.True(t, os.IsNotExist(err))
+	data, err := os.ReadFile(filepath.Join(dir, "root", "__", "escape"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "a", string(data))
+	data, err = os.ReadFile(filepath.Join(dir, "root", "sub", "AUX_"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "b", string(data))
+}
@@ -0,0 +1,144 @@
+package torrent
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+)
+
+/*
+	web seed(BEP 19)：从HTTP镜像下载piece
+		单文件种子：url以'/'结尾时在后面加上name，否则url就是文件的地址
+		多文件种子：每个文件的地址是 url/name/path...
+	piece按它覆盖的文件拆成多个Range请求，拼接后和peer下载的piece一样校验
+*/
+
+//连续失败这么多次后放弃这个web seed
+const webSeedMaxFails = 3
+
+//一段连续的数据在某个文件中的位置
+type fileSegment struct {
+	file	FileInfo
+	offset	int		//在文件中的起始位置
+	pos		int		//在piece中的起始位置
+	length	int
+}
+
+//把从begin开始、长度为length的数据拆分到它覆盖的文件中
+func (task *TorrentTask) fileSegments(begin int, length int) []fileSegment{
+	files := task.Files
+	if len(files) == 0{
+		files = []FileInfo{{Length: task.FileLen}}
+	}
+	end := begin + length
+	var segs []fileSegment
+	for _, f := range files{
+		fend := f.Offset + f.Length
+		if f.Length == 0 || fend <= begin || f.Offset >= end{
+			continue
+		}
+		sbegin, send := begin, end
+		if sbegin < f.Offset{
+			sbegin = f.Offset
+		}
+		if send > fend{
+			send = fend
+		}
+		segs = append(segs, fileSegment{f, sbegin - f.Offset, sbegin - begin, send - sbegin})
+	}
+	return segs
+}
+
+//文件在web seed上的地址
+func (task *TorrentTask) webSeedURL(seed string, f FileInfo) string{
+	name := filepath.Base(task.FileName)
+	if task.singleFile(){
+		if strings.HasSuffix(seed, "/"){
+			return seed + url.PathEscape(name)
+		}
+		return seed
+	}
+	if !strings.HasSuffix(seed, "/"){
+		seed += "/"
+	}
+	parts := make([]string, 0, len(f.Path) + 1)
+	parts = append(parts, url.PathEscape(name))
+	for _, p := range f.Path{
+		parts = append(parts, url.PathEscape(p))
+	}
+	return seed + strings.Join(parts, "/")
+}
+
+func (task *TorrentTask) webSeedRoutine(seed string, taskQueue chan *pieceTask, resultQueue chan *pieceResult){
+	if !strings.HasPrefix(seed, "http://") && !strings.HasPrefix(seed, "https://"){
+		fmt.Println("unsupported web seed: " + seed)
+		return
+	}
+	cli := &http.Client{Timeout: 30 * time.Second}
+	fails := 0
+	for piece := range taskQueue{
+		res, err := task.downloadWebSeedPiece(cli, seed, piece)
+		if err == nil && !checkPiece(piece, res){
+			err = fmt.Errorf("piece %d check failed", piece.index)
+		}
+		if err != nil{
+			taskQueue <- piece
+			fmt.Println("fail to download piece from web seed " + seed + ": " + err.Error())
+			fails++
+			if fails >= webSeedMaxFails{
+				return
+			}
+			continue
+		}
+		fails = 0
+		resultQueue <- res
+	}
+}
+
+//按piece覆盖的文件逐个发送Range请求，填充文件不需要请求，内容全为0
+func (task *TorrentTask) downloadWebSeedPiece(cli *http.Client, seed string, piece *pieceTask) (*pieceResult, error){
+	data := make([]byte, piece.length)
+	for _, seg := range task.fileSegments(piece.begin, piece.length){
+		if seg.file.Padding{
+			continue
+		}
+		err := fetchRange(cli, task.webSeedURL(seed, seg.file), seg.offset, data[seg.pos : seg.pos + seg.length])
+		if err != nil{
+			return nil, err
+		}
+	}
+	return &pieceResult{index: piece.index, data: data}, nil
+}
+
+//请求u中从offset开始、长度为len(buf)的数据
+func fetchRange(cli *http.Client, u string, offset int, buf []byte) error{
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil{
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset + len(buf) - 1))
+	resp, err := cli.Do(req)
+	if err != nil{
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		//服务器不支持Range时返回整个文件，跳过前面的部分
+		_, err := io.CopyN(io.Discard, resp.Body, int64(offset))
+		if err != nil{
+			return err
+		}
+	default:
+		return fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	_, err = io.ReadFull(resp.Body, buf)
+	return err
+}
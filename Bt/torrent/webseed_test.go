@@ -0,0 +1,133 @@
+package torrent
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+)
+
+//制作种子，并用一个httptest server作为web seed提供srcDir中的文件
+func newWebSeedTask(t *testing.T, srcDir string, path string, seed func(url string) string) *TorrentTask {
+	srv := httptest.NewServer(http.FileServer(http.Dir(srcDir)))
+	t.Cleanup(srv.Close)
+	tf, err := Create(new(bytes.Buffer), path, CreateOptions{PieceLen: MinPieceLen})
+	assert.Equal(t, nil, err)
+	return &TorrentTask{
+		WebSeeds: []string{"ftp://unsupported/", seed(srv.URL)},
+		InfoSHA:  tf.InfoSHA,
+		FileName: filepath.Join(t.TempDir(), tf.FileName),
+		FileLen:  tf.FileLen,
+		Files:    tf.Files,
+		PieceLen: tf.PieceLen,
+		PieceSHA: tf.PieceSHA,
+	}
+}
+
+func TestWebSeedMultiFile(t *testing.T) {
+	src := t.TempDir()
+	root := filepath.Join(src, "my data")
+	assert.Equal(t, nil, os.MkdirAll(filepath.Join(root, "sub"), 0755))
+	a := bytes.Repeat([]byte("a"), 10000)
+	b := bytes.Repeat([]byte("0123456789"), 5000)
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(root, "a"), a, 0644))
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(root, "empty"), nil, 0644))
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(root, "sub", "b c"), b, 0644))
+
+	//多文件：url/name/path
+	task := newWebSeedTask(t, src, root, func(url string) string { return url })
+	assert.Equal(t, 4, len(task.PieceSHA))
+	assert.Equal(t, nil, Download(task))
+
+	got, err := os.ReadFile(filepath.Join(task.FileName, "a"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, a, got)
+	got, err = os.ReadFile(filepath.Join(task.FileName, "sub", "b c"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, b, got)
+}
+
+func TestWebSeedSingleFile(t *testing.T) {
+	src := t.TempDir()
+	data := bytes.Repeat([]byte("xyz"), 20000)
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(src, "file.iso"), data, 0644))
+
+	//url不以'/'结尾时就是文件的地址
+	task := newWebSeedTask(t, src, filepath.Join(src, "file.iso"), func(url string) string { return url + "/file.iso" })
+	assert.Equal(t, nil, Download(task))
+	got, err := os.ReadFile(task.FileName)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, data, got)
+
+	assert.Equal(t, "http://a/dir/file.iso", task.webSeedURL("http://a/dir/", FileInfo{}))
+	assert.Equal(t, "http://a/x.iso", task.webSeedURL("http://a/x.iso", FileInfo{}))
+}
+
+func TestWebSeedBadData(t *testing.T) {
+	//镜像上的数据和种子不一致，校验失败的piece不会写入
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "f", time.Time{}, bytes.NewReader(bytes.Repeat([]byte("x"), 100)))
+	}))
+	defer srv.Close()
+	task := &TorrentTask{FileName: "f", FileLen: 100, PieceLen: MinPieceLen, PieceSHA: make([][SHALEN]byte, 1)}
+	pieces := task.pieceTasks()
+	res, err := task.downloadWebSeedPiece(srv.Client(), srv.URL + "/f", pieces[0])
+	assert.Equal(t, nil, err)
+	assert.Equal(t, bytes.Repeat([]byte("x"), 100), res.data)
+	assert.False(t, checkPiece(pieces[0], res))
+
+	//镜像上的文件比种子中的短
+	task.FileLen = 200
+	_, err = task.downloadWebSeedPiece(srv.Client(), srv.URL + "/f", &pieceTask{begin: 90, length: 20})
+	assert.NotEqual(t, nil, err)
+}
+
+func TestWebSeedV2SingleFile(t *testing.T) {
+	src := t.TempDir()
+	data := bytes.Repeat([]byte("v2 data "), 10000)
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(src, "f.iso"), data, 0644))
+	srv := httptest.NewServer(http.FileServer(http.Dir(src)))
+	defer srv.Close()
+
+	//v2的单文件种子在Files中也有一个文件，url的规则和v1的单文件种子相同
+	root, layer := v2Hashes(data)
+	tree := fileTree{{Path: []string{"f.iso"}, v2FileAttr: v2FileAttr{Length: len(data), PiecesRoot: string(root[:])}}}
+	info := &rawInfo{Name: "f.iso", PieceLength: v2PieceLen, MetaVersion: 2, FileTree: tree}
+	tf, err := ParseFile(bytes.NewReader(encodeTorrent(t, info, map[string]string{string(root[:]): string(layer)})))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(tf.Files))
+	task := &TorrentTask{
+		WebSeeds: []string{srv.URL + "/"},
+		InfoSHA:  tf.InfoSHA,
+		FileName: filepath.Join(t.TempDir(), tf.FileName),
+		FileLen:  tf.FileLen,
+		Files:    tf.Files,
+		PieceLen: tf.PieceLen,
+		V2:       true,
+	}
+	assert.Equal(t, "http://a/dir/f.iso", task.webSeedURL("http://a/dir/", tf.Files[0]))
+	assert.Equal(t, "http://a/f.iso", task.webSeedURL("http://a/f.iso", tf.Files[0]))
+
+	assert.Equal(t, nil, Download(task))
+	got, err := os.ReadFile(task.FileName)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, data, got)
+}
+
+func TestWebSeedAllFail(t *testing.T) {
+	//所有web seed都放弃后Download返回错误，不会一直等待
+	src := t.TempDir()
+	data := bytes.Repeat([]byte("xyz"), 20000)
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(src, "file.iso"), data, 0644))
+	task := newWebSeedTask(t, src, filepath.Join(src, "file.iso"), func(url string) string { return url + "/missing.iso" })
+	assert.NotEqual(t, nil, Download(task))
+
+	//没有peer也没有seed
+	task.WebSeeds = nil
+	assert.NotEqual(t, nil, Download(task))
+}